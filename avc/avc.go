@@ -0,0 +1,345 @@
+// Package avc reads and writes Resolume Arena composition files (.avc), so
+// clips can be added while Arena is closed.
+//
+// Only the elements the converter needs are modelled: decks, layers and
+// clips, addressed by their layerIndex and columnIndex attributes. Every other
+// element, attribute and piece of text is kept as it was. Comments,
+// processing instructions and the original formatting are not: the file is
+// re-indented on write. Namespaced attributes aren't supported, Arena doesn't
+// write any.
+package avc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Composition struct {
+	Root *Node
+
+	lastId int64
+}
+
+// New returns an empty composition with a single deck
+func New(name string, layers, columns int) *Composition {
+	c := &Composition{}
+	c.Root = NewNode("Composition",
+		"name", name,
+		"uniqueId", c.NewUniqueId(),
+		"numLayers", strconv.Itoa(layers),
+		"numColumns", strconv.Itoa(columns),
+		"numDecks", "1",
+		"currentDeckIndex", "0",
+	)
+	c.Root.AddChild(NewNode("versionInfo", "name", "Resolume Arena", "majorVersion", "7", "minorVersion", "0", "microVersion", "0", "revision", "0"))
+	for l := 0; l < layers; l++ {
+		c.Root.AddChild(NewNode("Layer",
+			"name", "Layer",
+			"uniqueId", c.NewUniqueId(),
+			"layerIndex", strconv.Itoa(l),
+		))
+	}
+	c.Root.AddChild(NewNode("Deck",
+		"name", "Deck 1",
+		"uniqueId", c.NewUniqueId(),
+		"closed", "0",
+		"numLayers", strconv.Itoa(layers),
+		"numColumns", strconv.Itoa(columns),
+		"deckIndex", "0",
+	))
+	return c
+}
+
+func Read(r io.Reader) (*Composition, error) {
+	root := &Node{}
+	err := xml.NewDecoder(r).Decode(root)
+	if err != nil {
+		return nil, err
+	}
+	if root.Name() != "Composition" {
+		return nil, fmt.Errorf("not a composition: root element is %s", root.Name())
+	}
+	root.trimText()
+	c := &Composition{Root: root}
+	root.Walk(func(n *Node) {
+		if id, err := strconv.ParseInt(n.Attr("uniqueId"), 10, 64); err == nil && id > c.lastId {
+			c.lastId = id
+		}
+	})
+	return c, nil
+}
+
+func ReadFile(path string) (*Composition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+func (c *Composition) Write(w io.Writer) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	err = enc.Encode(c.Root)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// WriteFile writes the composition next to path and renames it into place,
+// so Arena never sees a half written file. An existing file keeps its mode.
+func (c *Composition) WriteFile(path string) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	err = c.Write(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	// CreateTemp makes the file 0600
+	err = os.Chmod(f.Name(), mode)
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// NewUniqueId returns a uniqueId that isn't used anywhere in the composition.
+// Arena uses millisecond timestamps, so we do too.
+func (c *Composition) NewUniqueId() string {
+	id := time.Now().UnixMilli()
+	if id <= c.lastId {
+		id = c.lastId + 1
+	}
+	c.lastId = id
+	return strconv.FormatInt(id, 10)
+}
+
+func (c *Composition) NumLayers() int {
+	return attrInt(c.Root, "numLayers")
+}
+
+func (c *Composition) NumColumns() int {
+	return attrInt(c.Root, "numColumns")
+}
+
+func (c *Composition) Decks() []*Deck {
+	var v []*Deck
+	for _, n := range c.Root.ChildrenNamed("Deck") {
+		v = append(v, &Deck{Node: n, comp: c})
+	}
+	return v
+}
+
+// Deck finds a deck by name, or the first deck if name is empty
+func (c *Composition) Deck(name string) (*Deck, error) {
+	decks := c.Decks()
+	if len(decks) == 0 {
+		return nil, fmt.Errorf("composition has no decks")
+	}
+	if name == "" {
+		return decks[0], nil
+	}
+	for _, d := range decks {
+		if d.Attr("name") == name {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("no deck named %q", name)
+}
+
+// Paths returns the file path of every clip in every deck
+func (c *Composition) Paths() map[string]bool {
+	v := make(map[string]bool)
+	for _, d := range c.Decks() {
+		for _, clip := range d.Clips() {
+			if p := clip.Path(); p != "" {
+				v[p] = true
+			}
+		}
+	}
+	return v
+}
+
+type Deck struct {
+	*Node
+	comp *Composition
+}
+
+func (d *Deck) NumColumns() int {
+	return attrInt(d.Node, "numColumns")
+}
+
+// SetNumColumns grows the deck, and the composition with it if needed
+func (d *Deck) SetNumColumns(n int) {
+	d.SetAttr("numColumns", strconv.Itoa(n))
+	if d.comp.NumColumns() < n {
+		d.comp.Root.SetAttr("numColumns", strconv.Itoa(n))
+	}
+}
+
+func (d *Deck) Clips() []*Clip {
+	var v []*Clip
+	for _, n := range d.ChildrenNamed("Clip") {
+		v = append(v, &Clip{Node: n})
+	}
+	return v
+}
+
+// Clip returns the clip in the given slot, or nil if it's empty. Layers and
+// columns are 1 indexed, like everywhere else in the converter.
+func (d *Deck) Clip(layer, column int) *Clip {
+	for _, c := range d.Clips() {
+		if c.Layer() == layer && c.Column() == column {
+			return c
+		}
+	}
+	return nil
+}
+
+// EmptyColumns returns the columns of layer that have no clip in them
+func (d *Deck) EmptyColumns(layer int) []int {
+	used := make(map[int]bool)
+	for _, c := range d.Clips() {
+		if c.Layer() == layer {
+			used[c.Column()] = true
+		}
+	}
+	var v []int
+	for col := 1; col <= d.NumColumns(); col++ {
+		if !used[col] {
+			v = append(v, col)
+		}
+	}
+	return v
+}
+
+// ClipSpec describes a clip to add to a deck
+type ClipSpec struct {
+	Layer  int
+	Column int
+	Path   string
+	// Name defaults to the file name without its extension
+	Name string
+	// TransportType and Target are the option names shown in Arena, eg
+	// resolume.TransportDenon and resolume.TargetDenon. Empty leaves Arena's
+	// default.
+	TransportType string
+	Target        string
+}
+
+// AddClip adds a clip to an empty slot
+func (d *Deck) AddClip(spec ClipSpec) (*Clip, error) {
+	if spec.Layer < 1 || spec.Layer > d.comp.NumLayers() {
+		return nil, fmt.Errorf("layer %d out of range 1-%d", spec.Layer, d.comp.NumLayers())
+	}
+	if spec.Column < 1 {
+		return nil, fmt.Errorf("column %d out of range", spec.Column)
+	}
+	if d.Clip(spec.Layer, spec.Column) != nil {
+		return nil, fmt.Errorf("layer %d column %d is not empty", spec.Layer, spec.Column)
+	}
+	if spec.Column > d.NumColumns() {
+		d.SetNumColumns(spec.Column)
+	}
+	name := spec.Name
+	if name == "" {
+		base := filepath.Base(spec.Path)
+		name = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	n := NewNode("Clip",
+		"name", "Clip",
+		"uniqueId", d.comp.NewUniqueId(),
+		"layerIndex", strconv.Itoa(spec.Layer-1),
+		"columnIndex", strconv.Itoa(spec.Column-1),
+	)
+	preload := n.AddChild(NewNode("PreloadData"))
+	preload.AddChild(NewNode("VideoFile", "value", spec.Path))
+
+	params := n.AddChild(NewNode("Params", "name", "Params"))
+	params.AddChild(NewNode("Param", "name", "Name", "T", "STRING", "default", "", "value", name))
+	if spec.Target != "" {
+		params.AddChild(NewNode("ParamChoice", "name", "Target", "value", spec.Target))
+	}
+	if spec.TransportType != "" {
+		transport := n.AddChild(NewNode("Transport", "name", "Transport"))
+		transport.AddChild(NewNode("Params", "name", "Params")).
+			AddChild(NewNode("ParamChoice", "name", "TransportType", "value", spec.TransportType))
+	}
+
+	d.AddChild(n)
+	return &Clip{Node: n}, nil
+}
+
+type Clip struct {
+	*Node
+}
+
+// Layer is the 1 indexed layer of the clip
+func (c *Clip) Layer() int {
+	return attrInt(c.Node, "layerIndex") + 1
+}
+
+// Column is the 1 indexed column of the clip
+func (c *Clip) Column() int {
+	return attrInt(c.Node, "columnIndex") + 1
+}
+
+// Path is the video file the clip plays, or "" for generators and the like
+func (c *Clip) Path() string {
+	preload := c.Child("PreloadData")
+	if preload == nil {
+		return ""
+	}
+	video := preload.Child("VideoFile")
+	if video == nil {
+		return ""
+	}
+	return video.Attr("value")
+}
+
+func (c *Clip) Name() string {
+	params := c.Child("Params")
+	if params == nil {
+		return ""
+	}
+	for _, p := range params.Children {
+		if p.Attr("name") == "Name" {
+			return p.Attr("value")
+		}
+	}
+	return ""
+}
+
+func attrInt(n *Node, name string) int {
+	v, err := strconv.Atoi(n.Attr(name))
+	if err != nil {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,233 @@
+package avc
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files in testdata")
+
+// tree flattens n into one line per element, with its attributes and text,
+// to compare what two compositions hold regardless of formatting
+func tree(n *Node) []string {
+	var v []string
+	var walk func(n *Node, depth int)
+	walk = func(n *Node, depth int) {
+		var b strings.Builder
+		b.WriteString(strings.Repeat(" ", depth) + n.Name())
+		for _, a := range n.Attrs {
+			b.WriteString(" " + a.Name.Local + "=" + a.Value)
+		}
+		if n.Text != "" {
+			b.WriteString(" text=" + n.Text)
+		}
+		v = append(v, b.String())
+		for _, c := range n.Children {
+			walk(c, depth+1)
+		}
+	}
+	walk(n, 0)
+	return v
+}
+
+func write(t *testing.T, c *Composition) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	in, err := ReadFile(filepath.Join("testdata", "arena.avc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := write(t, in)
+
+	golden := filepath.Join("testdata", "arena.golden.avc")
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("writing arena.avc doesn't match arena.golden.avc (go test -update rewrites it), got:\n%s", got)
+	}
+
+	// Nothing is lost, and writing again changes nothing
+	out, err := Read(bytes.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := tree(in.Root), tree(out.Root); !reflect.DeepEqual(a, b) {
+		t.Errorf("read back as\n%s\nwant\n%s", strings.Join(b, "\n"), strings.Join(a, "\n"))
+	}
+	if again := write(t, out); !bytes.Equal(again, got) {
+		t.Errorf("writing twice gives\n%s", again)
+	}
+}
+
+func TestReadNotAComposition(t *testing.T) {
+	if _, err := Read(strings.NewReader(`<Deck name="Deck 1"/>`)); err == nil {
+		t.Error("read a deck as a composition")
+	}
+	if _, err := Read(strings.NewReader(`not xml`)); err == nil {
+		t.Error("read something that isn't XML")
+	}
+}
+
+func TestReadFixture(t *testing.T) {
+	c, err := ReadFile(filepath.Join("testdata", "arena.avc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.NumLayers() != 2 || c.NumColumns() != 3 {
+		t.Errorf("got %d layers %d columns, want 2 and 3", c.NumLayers(), c.NumColumns())
+	}
+	deck, err := c.Deck("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deck.Attr("name") != "Deck 1" {
+		t.Errorf("first deck is %q", deck.Attr("name"))
+	}
+	clip := deck.Clip(1, 1)
+	if clip == nil {
+		t.Fatal("no clip in layer 1 column 1")
+	}
+	if clip.Path() != "/Users/dj/Videos/Café del Mar.mov" || clip.Name() != "Café del Mar" {
+		t.Errorf("got clip %q playing %q", clip.Name(), clip.Path())
+	}
+	// A generator plays no file
+	if gen := deck.Clip(2, 3); gen == nil || gen.Path() != "" {
+		t.Errorf("got generator %+v", gen)
+	}
+	if _, err := c.Deck("Encore"); err != nil {
+		t.Error(err)
+	}
+	if _, err := c.Deck("Nope"); err == nil {
+		t.Error("found a deck that isn't there")
+	}
+
+	want := map[string]bool{"/Users/dj/Videos/Café del Mar.mov": true, "/Users/dj/Videos/Don't Stop.mov": true}
+	if got := c.Paths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got paths %v", got)
+	}
+	// New ids are past the ones in the file
+	if id, _ := strconv.ParseInt(c.NewUniqueId(), 10, 64); id <= 1712000000007 {
+		t.Errorf("got id %d, which may be taken", id)
+	}
+}
+
+func TestEmptyColumns(t *testing.T) {
+	c, err := ReadFile(filepath.Join("testdata", "arena.avc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deck, _ := c.Deck("")
+	tests := []struct {
+		layer int
+		want  []int
+	}{
+		{1, []int{2, 3}},
+		{2, []int{1, 2}},
+		{3, []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		if got := deck.EmptyColumns(tt.layer); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("layer %d: got empty columns %v, want %v", tt.layer, got, tt.want)
+		}
+	}
+	encore, _ := c.Deck("Encore")
+	if got := encore.EmptyColumns(1); got != nil {
+		t.Errorf("full layer has empty columns %v", got)
+	}
+}
+
+func TestAddClip(t *testing.T) {
+	c := New("Set", 2, 2)
+	deck, err := c.Deck("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clip, err := deck.AddClip(ClipSpec{Layer: 2, Column: 1, Path: "/videos/Some Song.mov", TransportType: "Denon DJ", Target: "Denon Player Determined"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clip.Layer() != 2 || clip.Column() != 1 || clip.Name() != "Some Song" || clip.Path() != "/videos/Some Song.mov" {
+		t.Errorf("got clip %q in layer %d column %d playing %q", clip.Name(), clip.Layer(), clip.Column(), clip.Path())
+	}
+	if got := deck.EmptyColumns(2); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("got empty columns %v, want [2]", got)
+	}
+
+	// Past the last column grows the deck and the composition
+	if _, err := deck.AddClip(ClipSpec{Layer: 1, Column: 4, Path: "/videos/b.mov", Name: "Other"}); err != nil {
+		t.Fatal(err)
+	}
+	if deck.NumColumns() != 4 || c.NumColumns() != 4 {
+		t.Errorf("got %d columns in the deck and %d in the composition, want 4", deck.NumColumns(), c.NumColumns())
+	}
+
+	for _, spec := range []ClipSpec{
+		{Layer: 2, Column: 1, Path: "/videos/taken.mov"},
+		{Layer: 0, Column: 1, Path: "/videos/a.mov"},
+		{Layer: 3, Column: 1, Path: "/videos/a.mov"},
+		{Layer: 1, Column: 0, Path: "/videos/a.mov"},
+	} {
+		if _, err := deck.AddClip(spec); err == nil {
+			t.Errorf("added %+v", spec)
+		}
+	}
+
+	// Everything survives a write
+	out, err := Read(bytes.NewReader(write(t, c)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deck, _ = out.Deck("")
+	got := deck.Clip(2, 1)
+	if got == nil {
+		t.Fatal("clip lost on write")
+	}
+	transport := got.Child("Transport").Child("Params").Child("ParamChoice")
+	target := got.Child("Params").ChildrenNamed("ParamChoice")
+	if transport.Attr("value") != "Denon DJ" || len(target) != 1 || target[0].Attr("value") != "Denon Player Determined" {
+		t.Errorf("got transport %q target %v", transport.Attr("value"), target)
+	}
+	if clip := deck.Clip(1, 4); clip == nil || clip.Name() != "Other" {
+		t.Errorf("got %+v in layer 1 column 4", clip)
+	}
+}
+
+func TestWriteFileKeepsMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "set.avc")
+	if err := os.WriteFile(path, nil, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := New("Set", 1, 1).WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mode().Perm() != 0640 {
+		t.Errorf("got mode %v, want 0640", st.Mode().Perm())
+	}
+	if _, err := ReadFile(path); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,91 @@
+package avc
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Node is a generic XML element. Compositions are kept as a tree of nodes so
+// that elements we don't understand are written back with the same
+// attributes, children and text. Whitespace around text is not kept.
+type Node struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []*Node    `xml:",any"`
+	Text     string     `xml:",chardata"`
+}
+
+func NewNode(name string, attrs ...string) *Node {
+	n := &Node{XMLName: xml.Name{Local: name}}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		n.SetAttr(attrs[i], attrs[i+1])
+	}
+	return n
+}
+
+func (n *Node) Name() string {
+	return n.XMLName.Local
+}
+
+// Attr returns the value of the named attribute, or "" if it isn't set
+func (n *Node) Attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (n *Node) SetAttr(name, value string) {
+	for i, a := range n.Attrs {
+		if a.Name.Local == name {
+			n.Attrs[i].Value = value
+			return
+		}
+	}
+	n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+}
+
+// Child returns the first child element with the given name
+func (n *Node) Child(name string) *Node {
+	for _, c := range n.Children {
+		if c.Name() == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// ChildrenNamed returns every child element with the given name
+func (n *Node) ChildrenNamed(name string) []*Node {
+	var v []*Node
+	for _, c := range n.Children {
+		if c.Name() == name {
+			v = append(v, c)
+		}
+	}
+	return v
+}
+
+func (n *Node) AddChild(c *Node) *Node {
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// Walk calls fn for n and every element below it, depth first
+func (n *Node) Walk(fn func(*Node)) {
+	fn(n)
+	for _, c := range n.Children {
+		c.Walk(fn)
+	}
+}
+
+// trimText drops the indentation the decoder collects as character data, so
+// the tree can be re-indented on write.
+func (n *Node) trimText() {
+	n.Text = strings.TrimSpace(n.Text)
+	for _, c := range n.Children {
+		c.trimText()
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bmurray/resolumeconverter/plan"
+	"github.com/bmurray/resolumeconverter/resolume"
+)
+
+// clipRow is one clip as clips list prints it
+type clipRow struct {
+	Id         int     `json:"id"`
+	Layer      int     `json:"layer"`
+	LayerId    int     `json:"layer_id"`
+	Column     int     `json:"column"`
+	Name       string  `json:"name"`
+	Path       string  `json:"path"`
+	Exists     bool    `json:"exists"`
+	DurationMS float32 `json:"duration_ms"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Transport  string  `json:"transport"`
+	Target     string  `json:"target"`
+}
+
+// clipFilter picks which clips are printed
+type clipFilter struct {
+	layerIds map[int]bool
+	missing  bool
+	nonDenon bool
+	name     *regexp.Regexp
+}
+
+func (f clipFilter) match(row clipRow) bool {
+	switch {
+	case f.layerIds != nil && !f.layerIds[row.LayerId]:
+		return false
+	case f.missing && (row.Exists || row.Path == ""):
+		return false
+	case f.nonDenon && row.Transport == resolume.TransportDenon:
+		return false
+	case f.name != nil && !f.name.MatchString(row.Name):
+		return false
+	}
+	return true
+}
+
+// clipQuery is what list and get print, and how
+type clipQuery struct {
+	comp   resolume.Composition
+	filter clipFilter
+	format string
+}
+
+// clipFlags parses the flags list and get share, and reads the composition
+// the filters apply to
+func clipFlags(ctx context.Context, r *resolume.Resolume, name string, args []string) (clipQuery, []string, error) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	layer := fs.String("layer", "", "Only clips in this layer, like 2, \"Deck 1\" or \"Music Videos/*\"")
+	missing := fs.Bool("missing", false, "Only clips whose file is missing")
+	nonDenon := fs.Bool("non-denon", false, "Only clips whose transport isn't Denon DJ")
+	namePattern := fs.String("name", "", "Only clips whose name matches this regular expression")
+	format := formatFlag(fs, "format", plan.FormatTable, plan.FormatJSON, plan.FormatCSV)
+	fs.Parse(args)
+
+	q := clipQuery{format: format.value}
+	q.filter.missing = *missing
+	q.filter.nonDenon = *nonDenon
+	if *namePattern != "" {
+		re, err := regexp.Compile(*namePattern)
+		if err != nil {
+			return q, nil, fmt.Errorf("bad name pattern: %w", err)
+		}
+		q.filter.name = re
+	}
+	var err error
+	q.comp, err = r.GetComposition(ctx)
+	if err != nil {
+		return q, nil, err
+	}
+	if *layer != "" {
+		ref, err := resolume.ParseLayerRef(*layer)
+		if err != nil {
+			return q, nil, err
+		}
+		layers, err := q.comp.ResolveLayers(ref)
+		if err != nil {
+			return q, nil, err
+		}
+		q.filter.layerIds = make(map[int]bool, len(layers))
+		for _, l := range layers {
+			q.filter.layerIds[l.Id] = true
+		}
+	}
+	return q, fs.Args(), nil
+}
+
+// clipRows lists the clips of the composition that have a name or a file,
+// leaving out empty slots
+func clipRows(comp resolume.Composition) []clipRow {
+	var rows []clipRow
+	for l, layer := range comp.Layers {
+		for c, clip := range layer.Clips {
+			info := clip.Video.FileInfo
+			if info.Path == "" && clip.Name.Value == "" {
+				continue
+			}
+			rows = append(rows, clipRow{
+				Id:         clip.Id,
+				Layer:      l + 1,
+				LayerId:    layer.Id,
+				Column:     c + 1,
+				Name:       clip.Name.Value,
+				Path:       info.Path,
+				Exists:     info.Exists,
+				DurationMS: info.DurationMS,
+				Width:      info.Width,
+				Height:     info.Height,
+				Transport:  clip.TransportType.Value,
+				Target:     clip.Target.Value,
+			})
+		}
+	}
+	return rows
+}
+
+// listClips prints every clip the filters let through
+func listClips(ctx context.Context, r *resolume.Resolume, args []string) {
+	q, _, err := clipFlags(ctx, r, "list", args)
+	if err != nil {
+		slog.Error("Error listing clips", "error", err)
+		return
+	}
+	var rows []clipRow
+	for _, row := range clipRows(q.comp) {
+		if q.filter.match(row) {
+			rows = append(rows, row)
+		}
+	}
+	err = writeClips(os.Stdout, q.format, rows)
+	if err != nil {
+		slog.Error("Error writing clips", "error", err)
+	}
+}
+
+// getClips prints the clips with the ids given, if the filters let them
+// through
+func getClips(ctx context.Context, r *resolume.Resolume, args []string) {
+	q, args, err := clipFlags(ctx, r, "get", args)
+	if err != nil {
+		slog.Error("Error getting clips", "error", err)
+		return
+	}
+	if len(args) == 0 {
+		slog.Error("No clip ID specified")
+		return
+	}
+	byId := make(map[int]clipRow)
+	for _, row := range clipRows(q.comp) {
+		byId[row.Id] = row
+	}
+	var rows []clipRow
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			slog.Error("Error parsing clip ID", "error", err)
+			return
+		}
+		row, ok := byId[id]
+		if !ok {
+			slog.Error("No clip with that ID", "id", id)
+			continue
+		}
+		if q.filter.match(row) {
+			rows = append(rows, row)
+		}
+	}
+	err = writeClips(os.Stdout, q.format, rows)
+	if err != nil {
+		slog.Error("Error writing clips", "error", err)
+	}
+}
+
+func writeClips(w io.Writer, format string, rows []clipRow) error {
+	switch format {
+	case plan.FormatJSON:
+		if rows == nil {
+			rows = []clipRow{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case plan.FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "layer", "column", "name", "path", "exists", "duration_ms", "width", "height", "transport", "target"})
+		for _, row := range rows {
+			cw.Write([]string{
+				strconv.Itoa(row.Id),
+				strconv.Itoa(row.Layer),
+				strconv.Itoa(row.Column),
+				row.Name,
+				row.Path,
+				strconv.FormatBool(row.Exists),
+				strconv.FormatFloat(float64(row.DurationMS), 'f', -1, 32),
+				strconv.Itoa(row.Width),
+				strconv.Itoa(row.Height),
+				row.Transport,
+				row.Target,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tLAYER\tCOLUMN\tNAME\tFILE\tEXISTS\tDURATION\tSIZE\tTRANSPORT\tTARGET")
+	for _, row := range rows {
+		duration := time.Duration(float64(row.DurationMS) * float64(time.Millisecond)).Round(time.Second)
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t%s\t%t\t%s\t%dx%d\t%s\t%s\n",
+			row.Id, row.Layer, row.Column, row.Name, row.Path, row.Exists, duration, row.Width, row.Height, row.Transport, row.Target)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,45 @@
+// Command fakeresolume serves an in-memory imitation of the Resolume REST API,
+// for working on the converter without Arena.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/bmurray/resolumeconverter/resolume"
+	"github.com/bmurray/resolumeconverter/resolume/resolumetest"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8089", "Address to listen on")
+	layers := flag.Int("layers", 3, "Number of layers in the empty composition")
+	columns := flag.Int("columns", 8, "Number of columns in the empty composition")
+	load := flag.String("load", "", "Serve a composition saved with `converter composition get` instead")
+	flag.Parse()
+
+	comp := resolumetest.NewComposition(*layers, *columns)
+	if *load != "" {
+		f, err := os.Open(*load)
+		if err != nil {
+			slog.Error("Error opening composition", "error", err)
+			os.Exit(1)
+		}
+		comp = resolume.Composition{}
+		err = json.NewDecoder(f).Decode(&comp)
+		f.Close()
+		if err != nil {
+			slog.Error("Error decoding composition", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	slog.Info("Serving fake resolume", "addr", *addr)
+	err := http.ListenAndServe(*addr, resolumetest.NewHandler(comp))
+	if err != nil {
+		slog.Error("Error serving", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bmurray/resolumeconverter/avc"
+	"github.com/bmurray/resolumeconverter/encoder"
+	"github.com/bmurray/resolumeconverter/library"
+	"github.com/bmurray/resolumeconverter/plan"
+	"github.com/bmurray/resolumeconverter/resolume"
+	"github.com/bmurray/resolumeconverter/state"
+)
+
+// Stages compare can diff
+const (
+	stageAudio       = "audio"
+	stageVideo       = "video"
+	stageComposition = "composition"
+)
+
+// Kinds of difference
+const (
+	diffMissing  = "missing"
+	diffExtra    = "extra"
+	diffStale    = "stale"
+	diffDuration = "duration"
+)
+
+// Exit codes, for scripts
+const (
+	exitSame    = 0
+	exitDiffers = 1
+	exitError   = 2
+)
+
+type diffEntry struct {
+	Kind   string `json:"kind"`
+	Source string `json:"source,omitempty"`
+	Output string `json:"output,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type diffSummary struct {
+	Missing  int `json:"missing"`
+	Extra    int `json:"extra"`
+	Stale    int `json:"stale"`
+	Duration int `json:"duration"`
+}
+
+type compareReport struct {
+	Stage   string      `json:"stage"`
+	Entries []diffEntry `json:"entries"`
+	Summary diffSummary `json:"summary"`
+}
+
+func (r *compareReport) add(e diffEntry) {
+	r.Entries = append(r.Entries, e)
+	switch e.Kind {
+	case diffMissing:
+		r.Summary.Missing++
+	case diffExtra:
+		r.Summary.Extra++
+	case diffStale:
+		r.Summary.Stale++
+	case diffDuration:
+		r.Summary.Duration++
+	}
+}
+
+// compareOptions are the flags of compare
+type compareOptions struct {
+	scan      scanFlags
+	durations bool
+	tolerance time.Duration
+	workers   int
+	avcFile   string
+}
+
+// compare diffs two stages of the pipeline: sources against their audio or
+// video outputs, or videos against the clips in the composition. It returns
+// the exit code.
+//
+//	compare audio <source dir> <audio dir>
+//	compare video <source dir> <video dir>
+//	compare composition <video dir>
+func compare(ctx context.Context, r *resolume.Resolume, db *state.DB, args []string) int {
+	if len(args) == 0 {
+		slog.Error("No stage specified: audio, video or composition")
+		return exitError
+	}
+	stage := args[0]
+	fs := flag.NewFlagSet("compare "+stage, flag.ExitOnError)
+	format := formatFlag(fs, "format", plan.FormatTable, plan.FormatJSON, plan.FormatCSV)
+	var opts compareOptions
+	opts.scan.register(fs)
+	fs.BoolVar(&opts.durations, "durations", true, "Compare durations, which reads every file with ffprobe")
+	fs.DurationVar(&opts.tolerance, "tolerance", time.Second, "How far durations may differ")
+	fs.IntVar(&opts.workers, "j", runtime.NumCPU(), "Number of files to read at once")
+	if stage == stageComposition {
+		fs.StringVar(&opts.avcFile, "avc", "", "Compare with this composition file instead of Arena")
+	}
+	fs.Parse(args[1:])
+	args = fs.Args()
+
+	var report compareReport
+	var err error
+	switch stage {
+	case stageAudio, stageVideo:
+		if len(args) < 2 {
+			slog.Error("Need a source dir and an output dir")
+			return exitError
+		}
+		report, err = compareOutputs(ctx, opts, stage, args[0], args[1])
+	case stageComposition:
+		if len(args) < 1 {
+			slog.Error("Need a video dir")
+			return exitError
+		}
+		report, err = compareComposition(ctx, r, db, opts, args[0])
+	default:
+		slog.Error("Unknown stage, use audio, video or composition", "stage", stage)
+		return exitError
+	}
+	if err != nil {
+		slog.Error("Error comparing", "error", err)
+		return exitError
+	}
+
+	switch format.value {
+	case plan.FormatJSON:
+		if report.Entries == nil {
+			report.Entries = []diffEntry{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	case plan.FormatCSV:
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"kind", "source", "output", "detail"})
+		for _, e := range report.Entries {
+			w.Write([]string{e.Kind, e.Source, e.Output, e.Detail})
+		}
+		w.Flush()
+		err = w.Error()
+	default:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "KIND\tSOURCE\tOUTPUT\tDETAIL")
+		for _, e := range report.Entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Kind, dashIfEmpty(e.Source), dashIfEmpty(e.Output), e.Detail)
+		}
+		err = tw.Flush()
+	}
+	if err != nil {
+		slog.Error("Error writing report", "error", err)
+		return exitError
+	}
+	sum := report.Summary
+	slog.Info("Compared", "stage", stage, "missing", sum.Missing, "extra", sum.Extra, "stale", sum.Stale, "duration", sum.Duration)
+	if len(report.Entries) > 0 {
+		return exitDiffers
+	}
+	return exitSame
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// compareOutputs diffs sources against the audio or video made from them.
+// An output belongs to a source if it has the same name in the same
+// subfolder, whatever its extension, or failing that the same name anywhere,
+// like Alley's flat output folder.
+func compareOutputs(ctx context.Context, opts compareOptions, stage, srcDir, outDir string) (compareReport, error) {
+	report := compareReport{Stage: stage}
+	sources, err := opts.scan.scan(ctx, srcDir)
+	if err != nil {
+		return report, err
+	}
+	// Folders left out of the sources are left out of the outputs too
+	scanOpts := []library.ScannerOption{library.WithExclude(opts.scan.exclude...)}
+	if stage != stageVideo {
+		scanOpts = append(scanOpts, library.WithAudio())
+	}
+	s, err := library.NewScanner(scanOpts...)
+	if err != nil {
+		return report, err
+	}
+	outputs, err := s.Scan(ctx, outDir)
+	if err != nil {
+		return report, err
+	}
+	skipped, err := skippedSources(ctx, srcDir, sources)
+	if err != nil {
+		return report, err
+	}
+
+	byRel := make(map[string]int)
+	byBase := make(map[string][]int)
+	for i, o := range outputs {
+		byRel[trimExt(o.Rel)] = i
+		base := path.Base(trimExt(o.Rel))
+		byBase[base] = append(byBase[base], i)
+	}
+	paired := make(map[int]int)
+	used := make([]bool, len(outputs))
+	for i, src := range sources {
+		j, ok := byRel[trimExt(src.Rel)]
+		if !ok {
+			if same := byBase[path.Base(trimExt(src.Rel))]; len(same) == 1 {
+				j, ok = same[0], true
+			}
+		}
+		if !ok || used[j] {
+			report.add(diffEntry{Kind: diffMissing, Source: src.Path, Detail: "no " + stage})
+			continue
+		}
+		used[j] = true
+		paired[i] = j
+	}
+
+	var durations map[string]time.Duration
+	if opts.durations {
+		var files []string
+		for i, j := range paired {
+			files = append(files, sources[i].Path, outputs[j].Path)
+		}
+		durations, err = probeDurations(ctx, opts.workers, files)
+		if err != nil {
+			return report, err
+		}
+	}
+	for i, src := range sources {
+		j, ok := paired[i]
+		if !ok {
+			continue
+		}
+		out := outputs[j]
+		if newer, detail := isNewer(src.Path, out.Path); newer {
+			report.add(diffEntry{Kind: diffStale, Source: src.Path, Output: out.Path, Detail: detail})
+		}
+		if detail, ok := durationDiffers(durations, src.Path, out.Path, opts.tolerance); ok {
+			report.add(diffEntry{Kind: diffDuration, Source: src.Path, Output: out.Path, Detail: detail})
+		}
+	}
+	for j, out := range outputs {
+		if !used[j] && !skipped[trimExt(out.Rel)] && !skipped[path.Base(trimExt(out.Rel))] {
+			report.add(diffEntry{Kind: diffExtra, Output: out.Path, Detail: "no source"})
+		}
+	}
+	return report, nil
+}
+
+// skippedSources names the sources that the -include and -exclude globs
+// left out, by their path and their name without an extension. Their
+// outputs aren't extras. The globs can't simply be applied to the outputs,
+// "*.mp4" would leave them all out.
+func skippedSources(ctx context.Context, srcDir string, sources []library.File) (map[string]bool, error) {
+	s, err := library.NewScanner()
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.Scan(ctx, srcDir)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool, len(sources))
+	for _, src := range sources {
+		used[src.Rel] = true
+	}
+	skipped := make(map[string]bool)
+	for _, src := range all {
+		if !used[src.Rel] {
+			skipped[trimExt(src.Rel)] = true
+			skipped[path.Base(trimExt(src.Rel))] = true
+		}
+	}
+	return skipped, nil
+}
+
+// compClip is a clip that plays a file
+type compClip struct {
+	path     string
+	exists   bool
+	duration time.Duration
+	where    string
+}
+
+// compareComposition diffs the videos in videoDir against the clips in the
+// composition: videos without a clip, clips of videos that aren't there,
+// videos changed since they were imported, and clips whose length is off
+func compareComposition(ctx context.Context, r *resolume.Resolume, db *state.DB, opts compareOptions, videoDir string) (compareReport, error) {
+	report := compareReport{Stage: stageComposition}
+	videos, err := opts.scan.scan(ctx, videoDir)
+	if err != nil {
+		return report, err
+	}
+	clips, err := compositionFiles(ctx, r, opts.avcFile)
+	if err != nil {
+		return report, err
+	}
+	root, err := filepath.Abs(videoDir)
+	if err != nil {
+		return report, err
+	}
+
+	byPath := make(map[string]compClip, len(clips))
+	for _, c := range clips {
+		byPath[c.path] = c
+	}
+	found := make(map[string]bool, len(videos))
+	var paired []string
+	for _, v := range videos {
+		file, err := filepath.Abs(v.Path)
+		if err != nil {
+			return report, err
+		}
+		found[file] = true
+		if _, ok := byPath[file]; !ok {
+			report.add(diffEntry{Kind: diffMissing, Source: file, Detail: "no clip"})
+			continue
+		}
+		paired = append(paired, file)
+	}
+
+	var durations map[string]time.Duration
+	if opts.durations {
+		durations, err = probeDurations(ctx, opts.workers, paired)
+		if err != nil {
+			return report, err
+		}
+	}
+	for _, file := range paired {
+		c := byPath[file]
+		if t, ok := db.FindVideo(file); ok && !t.ImportedAt.IsZero() {
+			if st, err := os.Stat(file); err == nil && st.ModTime().After(t.ImportedAt) {
+				report.add(diffEntry{Kind: diffStale, Source: file, Output: c.where, Detail: "changed since it was imported"})
+			}
+		}
+		got, ok := durations[file]
+		if c.duration > 0 && ok && absDuration(got-c.duration) > opts.tolerance {
+			report.add(diffEntry{Kind: diffDuration, Source: file, Output: c.where,
+				Detail: fmt.Sprintf("file is %s, clip is %s", got.Round(time.Millisecond), c.duration.Round(time.Millisecond))})
+		}
+	}
+	// Only clips from this folder count, the rest of the composition isn't
+	// this comparison's business
+	for _, c := range clips {
+		if found[c.path] || !strings.HasPrefix(c.path, root+string(filepath.Separator)) {
+			continue
+		}
+		detail := "file isn't in the folder"
+		if !c.exists {
+			detail = "file is gone"
+		}
+		report.add(diffEntry{Kind: diffExtra, Source: c.path, Output: c.where, Detail: detail})
+	}
+	return report, nil
+}
+
+// compositionFiles lists the clips that play a file, from Arena or from a
+// composition file
+func compositionFiles(ctx context.Context, r *resolume.Resolume, avcFile string) ([]compClip, error) {
+	var clips []compClip
+	if avcFile != "" {
+		comp, err := avc.ReadFile(avcFile)
+		if err != nil {
+			return nil, err
+		}
+		var paths []string
+		for p := range comp.Paths() {
+			paths = append(paths, p)
+		}
+		// Sorted, so reports come out the same every time
+		slices.Sort(paths)
+		for _, p := range paths {
+			_, err := os.Stat(p)
+			clips = append(clips, compClip{path: p, exists: err == nil, where: avcFile})
+		}
+		return clips, nil
+	}
+	comp, err := r.GetComposition(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for l, layer := range comp.Layers {
+		for c, clip := range layer.Clips {
+			info := clip.Video.FileInfo
+			if info.Path == "" {
+				continue
+			}
+			clips = append(clips, compClip{
+				path:     info.Path,
+				exists:   info.Exists,
+				duration: time.Duration(float64(info.DurationMS) * float64(time.Millisecond)),
+				where:    fmt.Sprintf("layer %d column %d", l+1, c+1),
+			})
+		}
+	}
+	return clips, nil
+}
+
+// probeDurations reads the duration of each file. Files that can't be read
+// are left out.
+func probeDurations(ctx context.Context, workers int, files []string) (map[string]time.Duration, error) {
+	enc := encoder.NewEncoder()
+	durations := make(map[string]time.Duration, len(files))
+	var mu sync.Mutex
+	jobs := make([]encoder.Job, len(files))
+	for i, file := range files {
+		jobs[i] = encoder.Job{
+			Name: file,
+			Run: func(ctx context.Context) error {
+				data, err := enc.GetMetadata(ctx, file)
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				durations[file] = data.Duration()
+				mu.Unlock()
+				return nil
+			},
+		}
+	}
+	_, err := encoder.NewScheduler(encoder.WithWorkers(workers)).Run(ctx, jobs)
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	return durations, nil
+}
+
+// isNewer reports whether src was changed after out was written
+func isNewer(src, out string) (bool, string) {
+	ss, err := os.Stat(src)
+	if err != nil {
+		return false, ""
+	}
+	so, err := os.Stat(out)
+	if err != nil {
+		return false, ""
+	}
+	if !ss.ModTime().After(so.ModTime()) {
+		return false, ""
+	}
+	return true, fmt.Sprintf("source is %s newer", ss.ModTime().Sub(so.ModTime()).Round(time.Second))
+}
+
+func durationDiffers(durations map[string]time.Duration, src, out string, tolerance time.Duration) (string, bool) {
+	want, ok := durations[src]
+	if !ok {
+		return "", false
+	}
+	got, ok := durations[out]
+	if !ok || absDuration(got-want) <= tolerance {
+		return "", false
+	}
+	return fmt.Sprintf("source is %s, output is %s", want.Round(time.Millisecond), got.Round(time.Millisecond)), true
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func trimExt(p string) string {
+	return p[:len(p)-len(path.Ext(p))]
+}
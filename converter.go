@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -10,12 +11,23 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strconv"
 	"time"
 
+	"github.com/bmurray/resolumeconverter/avc"
 	"github.com/bmurray/resolumeconverter/encoder"
+	"github.com/bmurray/resolumeconverter/importer"
+	"github.com/bmurray/resolumeconverter/journal"
+	"github.com/bmurray/resolumeconverter/library"
+	"github.com/bmurray/resolumeconverter/naming"
+	"github.com/bmurray/resolumeconverter/plan"
 	"github.com/bmurray/resolumeconverter/resolume"
+	"github.com/bmurray/resolumeconverter/resolume/ws"
+	"github.com/bmurray/resolumeconverter/state"
 )
 
 func main() {
@@ -24,6 +36,9 @@ func main() {
 	defer cancel()
 
 	baseUrlString := flag.String("base-url", "http://127.0.0.1:8089/api/v1/", "Base URL of Resolume")
+	dryRun := flag.Bool("dry-run", false, "Print what would be changed instead of changing it")
+	planFormat := formatFlag(flag.CommandLine, "plan-format", plan.FormatTable, plan.FormatJSON)
+	statePath := flag.String("state", state.DefaultPath(), "File that remembers what has been done to each track")
 	flag.Parse()
 
 	baseUrl, err := url.Parse(*baseUrlString)
@@ -38,63 +53,89 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Mutating commands add to the plan instead of acting when it isn't nil
+	var p *plan.Plan
+	if *dryRun {
+		p = plan.New()
+		defer func() {
+			err := p.Write(os.Stdout, planFormat.value)
+			if err != nil {
+				slog.Error("Error writing plan", "error", err)
+			}
+		}()
+	}
+
+	// Only the commands that use the state open it, since a writer locks
+	// everyone else out. It stays nil in a dry run, which records nothing.
+	var db *state.DB
+	defer func() {
+		db.Close()
+	}()
+
+	// Commands that report differences return an exit code for scripts
+	exitCode := 0
 	switch args[0] {
 	case "clips":
-		clips(ctx, r, args[1:])
+		clips(ctx, r, p, args[1:])
 	case "layers":
-		layers(ctx, r, args[1:])
+		layers(ctx, r, p, args[1:])
 	case "composition":
 		composition(ctx, r, args[1:])
 	case "convert":
-		convert(ctx, r, args[1:])
+		if p == nil {
+			db = openState(*statePath)
+		}
+		convert(ctx, r, db, p, args[1:])
 	case "compare":
-		compare(ctx, args[1:])
+		if len(args) > 1 && args[1] == stageComposition {
+			db = openState(*statePath, state.WithReadOnly())
+		}
+		exitCode = compare(ctx, r, db, args[1:])
+	case "verify":
+		exitCode = verify(ctx, r, args[1:])
+	case "pair":
+		db = openState(*statePath, state.WithReadOnly())
+		pair(ctx, db, args[1:])
+	case "status":
+		db = openState(*statePath, state.WithReadOnly())
+		status(db, args[1:])
+	case "monitor":
+		monitor(ctx, ws.URLFromBase(baseUrl), args[1:])
 	default:
 		slog.Error("Unknown command", "command", args[0])
 	}
-
-}
-func compare(ctx context.Context, args []string) {
-	if len(args) < 2 {
-		slog.Error("Not enough arguments")
-		return
+	if exitCode != 0 {
+		// os.Exit skips the deferred calls
+		db.Close()
+		os.Exit(exitCode)
 	}
-	inDir := args[0]
-	outDir := args[1]
-	files, err := filepath.Glob(filepath.Join(inDir, "*.mp4"))
+}
+
+// openState opens the state database, or returns nil if it can't. Losing
+// track of state is no reason to stop converting.
+func openState(path string, opts ...state.Option) *state.DB {
+	db, err := state.Open(path, opts...)
 	if err != nil {
-		slog.Error("Error globbing files", "error", err)
-		return
-	}
-	for _, file := range files {
-		base := filepath.Base(file)
-		ext := filepath.Ext(base)
-		base = base[:len(base)-len(ext)]
-		outFile := filepath.Join(outDir, base+".mov")
-		if st, err := os.Stat(outFile); err == nil && st.Size() > 0 {
-			// slog.Info("Skipping", "file", file)
-			continue
-		}
-		slog.Info("File needs to be converted", "file", file)
+		slog.Warn("Not using state", "error", err)
+		return nil
 	}
-
-	// compareFiles(ctx, args[0], args[1])
+	return db
 }
 
-func clips(ctx context.Context, res *resolume.Resolume, args []string) {
+func clips(ctx context.Context, res *resolume.Resolume, p *plan.Plan, args []string) {
 
 	if len(args) == 0 {
-		// listClips(ctx, res)
+		listClips(ctx, res, nil)
 		return
 	}
 
 	switch args[0] {
 	case "list":
-		// listClips(ctx, res)
+		listClips(ctx, res, args[1:])
 	case "get":
-		// getClips(ctx, res)
+		getClips(ctx, res, args[1:])
 	case "thumbnail":
-		getThumbnail(ctx, res, args[1:])
+		getThumbnail(ctx, res, p, args[1:])
 	case "selected":
 		getSelectedClip(ctx, res)
 	default:
@@ -102,7 +143,7 @@ func clips(ctx context.Context, res *resolume.Resolume, args []string) {
 	}
 }
 
-func getThumbnail(ctx context.Context, r *resolume.Resolume, args []string) {
+func getThumbnail(ctx context.Context, r *resolume.Resolume, p *plan.Plan, args []string) {
 	if len(args) == 0 {
 		slog.Error("No clip ID specified")
 		return
@@ -113,6 +154,12 @@ func getThumbnail(ctx context.Context, r *resolume.Resolume, args []string) {
 		return
 	}
 
+	fname := fmt.Sprintf("%d.png", clipId)
+	if p != nil {
+		p.Add(plan.Action{Kind: plan.KindWriteFile, Source: fmt.Sprintf("clip %d", clipId), Target: fname, Detail: "thumbnail"})
+		return
+	}
+
 	thumbnail, err := r.GetThumbnail(ctx, clipId)
 	if err != nil {
 		slog.Error("Error getting thumbnail", "error", err)
@@ -120,7 +167,6 @@ func getThumbnail(ctx context.Context, r *resolume.Resolume, args []string) {
 	}
 	defer thumbnail.Close()
 
-	fname := fmt.Sprintf("%s.png", clipId)
 	f, err := os.Create(fname)
 	if err != nil {
 		slog.Error("Error creating file", "error", err)
@@ -146,7 +192,7 @@ func getSelectedClip(ctx context.Context, r *resolume.Resolume) {
 	enc.Encode(clips)
 }
 
-func layers(ctx context.Context, res *resolume.Resolume, args []string) {
+func layers(ctx context.Context, res *resolume.Resolume, p *plan.Plan, args []string) {
 
 	if len(args) == 0 {
 		listLayers(ctx, res)
@@ -157,6 +203,12 @@ func layers(ctx context.Context, res *resolume.Resolume, args []string) {
 		listLayers(ctx, res)
 	case "get":
 		getLayers(ctx, res)
+	case "groups":
+		listLayerGroups(ctx, res)
+	case "add-group":
+		addLayerGroup(ctx, res, p, args[1:])
+	case "move":
+		moveLayer(ctx, res, p, args[1:])
 	default:
 		slog.Error("Unknown command", "command", fmt.Sprintf("layer %s", args[0]))
 	}
@@ -168,7 +220,104 @@ func listLayers(ctx context.Context, r *resolume.Resolume) {
 		slog.Error("Error getting layers", "error", err)
 	}
 	for idx, layer := range layers {
-		fmt.Printf("%d: %s (%d)\n", idx, layer.Name.Value, layer.Id)
+		fmt.Printf("%d: %s (%d)\n", idx+1, layer.Name.Value, layer.Id)
+	}
+}
+
+func listLayerGroups(ctx context.Context, r *resolume.Resolume) {
+	comp, err := r.GetComposition(ctx)
+	if err != nil {
+		slog.Error("Error getting composition", "error", err)
+		return
+	}
+	for idx, group := range comp.Layergroups {
+		fmt.Printf("%d: %s (%d)\n", idx+1, group.Name.Value, group.Id)
+		for _, layer := range group.Layers {
+			pos, _, _ := comp.LayerById(layer.Id)
+			fmt.Printf("    %d: %s (%d)\n", pos, layer.Name.Value, layer.Id)
+		}
+	}
+}
+
+func addLayerGroup(ctx context.Context, r *resolume.Resolume, p *plan.Plan, args []string) {
+	if len(args) == 0 {
+		slog.Error("No group name specified")
+		return
+	}
+	if p != nil {
+		p.Add(plan.Action{Kind: plan.KindAddGroup, Target: args[0]})
+		return
+	}
+	group, err := r.AddLayerGroup(ctx, args[0])
+	if err != nil {
+		slog.Error("Error adding layer group", "error", err)
+		return
+	}
+	fmt.Printf("%s (%d)\n", group.Name.Value, group.Id)
+}
+
+// moveLayer moves layers into a group: layers move <group> <layer>...
+func moveLayer(ctx context.Context, r *resolume.Resolume, p *plan.Plan, args []string) {
+	if len(args) < 2 {
+		slog.Error("Usage: layers move <group> <layer>...")
+		return
+	}
+	comp, err := r.GetComposition(ctx)
+	if err != nil {
+		slog.Error("Error getting composition", "error", err)
+		return
+	}
+	group, err := comp.GroupByName(args[0])
+	if err != nil {
+		slog.Error("Error finding layer group", "error", err)
+		return
+	}
+
+	// Resolve everything up front, as moving layers renumbers them
+	var ids []int
+	for _, arg := range args[1:] {
+		ref, err := resolume.ParseLayerRef(arg)
+		if err != nil {
+			slog.Error("Error parsing layer", "error", err)
+			return
+		}
+		layers, err := comp.ResolveLayers(ref)
+		if err != nil {
+			slog.Error("Error finding layer", "error", err)
+			return
+		}
+		for _, layer := range layers {
+			ids = append(ids, layer.Id)
+		}
+	}
+	if p != nil {
+		for _, id := range ids {
+			_, layer, _ := comp.LayerById(id)
+			p.Add(plan.Action{Kind: plan.KindMoveLayer, Source: layer.Name.Value, Target: group.Name.Value, Detail: fmt.Sprintf("layer id %d", id)})
+		}
+		return
+	}
+	for _, id := range ids {
+		comp, err := r.GetComposition(ctx)
+		if err != nil {
+			slog.Error("Error getting composition", "error", err)
+			return
+		}
+		idx := 0
+		for i, g := range comp.Layergroups {
+			if g.Id == group.Id {
+				idx = i + 1
+			}
+		}
+		if idx == 0 {
+			slog.Error("Layer group disappeared", "group", args[0])
+			return
+		}
+		err = r.MoveLayerToGroup(ctx, id, idx)
+		if err != nil {
+			slog.Error("Error moving layer", "error", err)
+			return
+		}
 	}
 }
 
@@ -182,6 +331,65 @@ func getLayers(ctx context.Context, r *resolume.Resolume) {
 	enc.Encode(layers)
 }
 
+// monitor prints parameter updates pushed over the WebSocket API. Without any
+// parameter ids, it watches the connected state of every clip.
+func monitor(ctx context.Context, u *url.URL, args []string) {
+	c := ws.NewClient(u)
+	go c.Run(ctx)
+
+	ids := make([]int, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			slog.Error("Error parsing parameter ID", "error", err)
+			return
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.Ready():
+		}
+		comp, ok := c.Composition()
+		if !ok {
+			slog.Error("Error getting composition")
+			return
+		}
+		for _, layer := range comp.Layers {
+			for _, clip := range layer.Clips {
+				ids = append(ids, clip.Connected.Id)
+			}
+		}
+	}
+
+	updates := make(chan ws.Update)
+	for _, id := range ids {
+		ch, cancel := c.Subscribe(ctx, id)
+		defer cancel()
+		go func() {
+			for u := range ch {
+				select {
+				case updates <- u:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-updates:
+			enc.Encode(u)
+		}
+	}
+}
+
 func composition(ctx context.Context, res *resolume.Resolume, args []string) {
 
 	if len(args) == 0 {
@@ -206,7 +414,7 @@ func getComposition(ctx context.Context, r *resolume.Resolume) {
 	enc.Encode(composition)
 }
 
-func convert(ctx context.Context, r *resolume.Resolume, args []string) {
+func convert(ctx context.Context, r *resolume.Resolume, db *state.DB, p *plan.Plan, args []string) {
 
 	if len(args) == 0 {
 		slog.Error("No command specified")
@@ -215,101 +423,543 @@ func convert(ctx context.Context, r *resolume.Resolume, args []string) {
 
 	switch args[0] {
 	case "input":
-		if len(args) < 2 {
+		opts, args := convertFlags("input", args[1:])
+		opts.db = db
+		if len(args) < 1 {
 			slog.Error("No input dir specified specified")
 			return
 		}
-		convertInputs(ctx, args[1])
+		convertInputs(ctx, opts, args[0], p)
 	case "audio":
 		// Only do audio conversion
-		if len(args) < 3 {
+		opts, args := convertFlags("audio", args[1:])
+		opts.db = db
+		if len(args) < 2 {
 			slog.Error("No input dir specified specified")
 			return
 		}
-		inDir := args[1]
-		audioOutDir := args[2]
-		convertAudioFiles(ctx, encoder.NewEncoder(), inDir, audioOutDir)
+		inDir := args[0]
+		audioOutDir := args[1]
+		convertAudioFiles(ctx, opts, inDir, audioOutDir, p)
 	case "input-audio":
 		// Convert input and audio
-		if len(args) < 3 {
+		opts, args := convertFlags("input-audio", args[1:])
+		opts.db = db
+		if len(args) < 2 {
 			slog.Error("No input dir specified specified")
 			return
 		}
-		inDir := args[1]
-		audioOutDir := args[2]
+		inDir := args[0]
+		audioOutDir := args[1]
 
-		convertInputs(ctx, inDir)
-		convertAudioFiles(ctx, encoder.NewEncoder(), inDir, audioOutDir)
+		convertInputs(ctx, opts, inDir, p)
+		convertAudioFiles(ctx, opts, inDir, audioOutDir, p)
 
+	case "video":
+		convertVideo(ctx, db, p, args[1:])
 	case "import":
-		convertImport(ctx, r, args[1:])
+		convertImport(ctx, r, db, p, args[1:])
+	case "import-avc":
+		convertImportAvc(ctx, p, args[1:])
+	case "undo":
+		convertUndo(ctx, p, args[1:])
 	default:
 		slog.Error("Unknown command", "command", args[0])
 	}
 }
-func convertImport(ctx context.Context, r *resolume.Resolume, args []string) {
+func convertImport(ctx context.Context, r *resolume.Resolume, db *state.DB, p *plan.Plan, args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	grow := fs.String("grow", importer.GrowColumns, "What to do when the layers are full: columns (add columns), layer (add a layer in the same group) or none (stop)")
+	spread := fs.String("spread", importer.SpreadFill, "How to spread clips over a group's layers: fill (one layer at a time) or round-robin")
+	workers := fs.Int("j", 4, "Number of clips to open at once")
+	var scan scanFlags
+	scan.register(fs)
+	fs.Parse(args)
+	args = fs.Args()
+
+	switch *grow {
+	case importer.GrowColumns, importer.GrowLayer, importer.GrowNone:
+	default:
+		slog.Error("Unknown grow policy", "grow", *grow)
+		return
+	}
+	switch *spread {
+	case importer.SpreadFill, importer.SpreadRoundRobin:
+	default:
+		slog.Error("Unknown spread policy", "spread", *spread)
+		return
+	}
 
 	if len(args) < 2 {
 		slog.Error("No input dir specified specified")
 		return
 	}
 	indir := args[0]
-	layer, err := strconv.Atoi(args[1])
+	ref, err := resolume.ParseLayerRef(args[1])
+	if err != nil {
+		slog.Error("Error parsing layer", "error", err)
+		return
+	}
+	comp, err := r.GetComposition(ctx)
+	if err != nil {
+		slog.Error("Error getting composition", "error", err)
+		return
+	}
+	layers, err := comp.ResolveLayers(ref)
+	if err != nil {
+		slog.Error("Error finding layer", "error", err)
+		return
+	}
+	layerIds := make([]int, 0, len(layers))
+	for _, layer := range layers {
+		layerIds = append(layerIds, layer.Id)
+	}
+
+	// Only .mov files, which is what HAP and DXV come in, not the sources
+	found, err := scan.scan(ctx, indir, library.WithContainers(library.ContainerMOV))
+	if err != nil {
+		slog.Error("Error scanning files", "error", err)
+		return
+	}
+
+	// Resolume needs absolute paths, and reports them that way too
+	files := make([]string, len(found))
+	for i, file := range found {
+		files[i], err = filepath.Abs(file.Path)
+		if err != nil {
+			slog.Error("Error resolving path", "error", err)
+			return
+		}
+	}
+
+	im := importer.NewImporter(r,
+		importer.WithGrow(*grow),
+		importer.WithSpread(*spread),
+		importer.WithWorkers(*workers),
+		importer.WithDryRun(p != nil),
+	)
+	if p != nil {
+		placements, grown, err := im.Plan(ctx, files, layerIds)
+		if err != nil {
+			slog.Error("Error planning import", "error", err)
+		}
+		for i, pl := range placements {
+			for len(grown) > 0 && grown[0].Before <= i {
+				planGrowth(p, grown[0])
+				grown = grown[1:]
+			}
+			planPlacement(p, pl)
+		}
+		for _, g := range grown {
+			planGrowth(p, g)
+		}
+		return
+	}
+	results, err := im.Import(ctx, files, layerIds)
+	if err != nil {
+		slog.Error("Error importing files", "error", err)
+	}
+	// Read once, rather than looking through every track for every clip
+	videos, _ := db.Videos()
+	added := 0
+	for _, res := range results {
+		if res.Err != nil {
+			continue
+		}
+		if !res.Exists {
+			added++
+		}
+		recordClip(db, videos, res.Placement)
+	}
+	slog.Info("Import finished", "files", len(files), "added", added)
+}
+
+// recordClip remembers which clip a video ended up in, if the video is one
+// that was encoded from a known source
+func recordClip(db *state.DB, videos map[string]state.Track, pl importer.Placement) {
+	t, ok := videos[pl.File]
+	if !ok {
+		return
+	}
+	_, err := db.Update(t.Hash, func(t *state.Track) {
+		t.ClipId = pl.ClipId
+		t.LayerId = pl.LayerId
+		t.Layer = pl.Layer
+		t.Column = pl.Column
+		t.ImportedAt = time.Now()
+	})
+	if err != nil {
+		slog.Warn("Error recording state", "file", pl.File, "error", err)
+	}
+}
+
+func planGrowth(p *plan.Plan, g importer.Growth) {
+	switch g.Kind {
+	case importer.GrowColumns:
+		p.Add(plan.Action{Kind: plan.KindAddColumn, Target: fmt.Sprintf("column %d", g.Column), Detail: "layers are full"})
+	case importer.GrowLayer:
+		p.Add(plan.Action{Kind: plan.KindAddLayer, Target: fmt.Sprintf("layer %d", g.Layer), Detail: g.Group})
+	}
+}
+
+func planPlacement(p *plan.Plan, pl importer.Placement) {
+	if pl.Exists {
+		p.Add(plan.Action{Kind: plan.KindSkip, Source: pl.File, Detail: fmt.Sprintf("already in layer %d column %d", pl.Layer, pl.Column)})
+		return
+	}
+	detail := fmt.Sprintf("clip id %d", pl.ClipId)
+	if pl.New {
+		detail = "added to make room"
+	}
+	p.Add(plan.Action{
+		Kind:   plan.KindPlace,
+		Source: pl.File,
+		Target: fmt.Sprintf("layer %d column %d", pl.Layer, pl.Column),
+		Detail: detail,
+	})
+}
+
+// convertImportAvc adds clips straight into a composition file, for when
+// Arena isn't running
+func convertImportAvc(ctx context.Context, p *plan.Plan, args []string) {
+	fs := flag.NewFlagSet("import-avc", flag.ExitOnError)
+	deckName := fs.String("deck", "", "Deck to add clips to (default: the first deck)")
+	numColumns := fs.Int("columns", 8, "Number of columns when creating a new composition")
+	var scan scanFlags
+	scan.register(fs)
+	fs.Parse(args)
+	args = fs.Args()
+
+	if len(args) < 3 {
+		slog.Error("Usage: convert import-avc <input dir> <composition.avc> <layer>")
+		return
+	}
+	indir := args[0]
+	avcFile := args[1]
+	ref, err := resolume.ParseLayerRef(args[2])
 	if err != nil {
 		slog.Error("Error parsing layer", "error", err)
 		return
 	}
+	// Composition files only know layers by position
+	if ref.Index == 0 || ref.Group != "" {
+		slog.Error("Offline import needs a layer number", "layer", ref.String())
+		return
+	}
+	layer := ref.Index
+
+	comp, err := avc.ReadFile(avcFile)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("Creating composition", "file", avcFile)
+		name := filepath.Base(avcFile)
+		comp = avc.New(name[:len(name)-len(filepath.Ext(name))], layer, *numColumns)
+	} else if err != nil {
+		slog.Error("Error reading composition", "error", err)
+		return
+	}
+	deck, err := comp.Deck(*deckName)
+	if err != nil {
+		slog.Error("Error finding deck", "error", err)
+		return
+	}
 
-	files, err := filepath.Glob(filepath.Join(indir, "*.mov"))
+	files, err := scan.scan(ctx, indir, library.WithContainers(library.ContainerMOV))
 	if err != nil {
-		slog.Error("Error globbing files", "error", err)
+		slog.Error("Error scanning files", "error", err)
 		return
 	}
 
+	existing := comp.Paths()
+	empty := deck.EmptyColumns(layer)
+	next := deck.NumColumns() + 1
+	added := 0
 	for _, file := range files {
-		err := convertAddToResolume(ctx, r, file, layer)
+		if ctx.Err() != nil {
+			return
+		}
+		file, err := filepath.Abs(file.Path)
 		if err != nil {
-			slog.Error("Error converting file", "error", err)
+			slog.Error("Error resolving path", "error", err)
 			return
 		}
+		if existing[file] {
+			slog.Info("Clip already exists", "clip", file)
+			continue
+		}
+		// Fill the gaps first, then add columns on the end
+		column := next
+		if len(empty) > 0 {
+			column, empty = empty[0], empty[1:]
+		} else {
+			next++
+		}
+		_, err = deck.AddClip(avc.ClipSpec{
+			Layer:         layer,
+			Column:        column,
+			Path:          file,
+			TransportType: resolume.TransportDenon,
+			Target:        resolume.TargetDenon,
+		})
+		if err != nil {
+			slog.Error("Error adding clip", "error", err)
+			return
+		}
+		existing[file] = true
+		added++
+		if p != nil {
+			p.Add(plan.Action{Kind: plan.KindPlace, Source: file, Target: fmt.Sprintf("layer %d column %d", layer, column), Detail: avcFile})
+		}
+	}
+
+	if p != nil {
+		p.Add(plan.Action{Kind: plan.KindWriteFile, Target: avcFile, Detail: fmt.Sprintf("%d clips added", added)})
+		return
+	}
+	err = comp.WriteFile(avcFile)
+	if err != nil {
+		slog.Error("Error writing composition", "error", err)
+		return
 	}
+	slog.Info("Wrote composition", "file", avcFile, "added", added)
 }
 
-func convertInputs(ctx context.Context, inDir string) {
+func convertInputs(ctx context.Context, opts convertOptions, inDir string, p *plan.Plan) {
 	// if len(args) < 1 {
 	// 	slog.Error("No input dir specified specified")
 	// 	return
 	// }
 	// inDir := args[0]
-	files, err := filepath.Glob(filepath.Join(inDir, "*.mp4"))
+	found, err := opts.scan.scan(ctx, inDir)
 	if err != nil {
-		slog.Error("Error globbing files", "error", err)
+		slog.Error("Error scanning files", "error", err)
 		return
 	}
+	db := opts.db
+	// Titles only have to be unique within a folder
+	namers := make(map[string]*naming.Namer)
 	enc := encoder.NewEncoder()
-	for _, file := range files {
+	var j *journal.Journal
+	if p == nil {
+		j, err = journal.Open(inDir)
+		if err != nil {
+			slog.Error("Error opening journal", "error", err)
+			return
+		}
+		defer j.Close()
+	}
+	for _, f := range found {
+		file := f.Path
 		slog.Info("Converting", "file", file)
 
-		audioTitle, err := getAudioTitle(ctx, enc, file)
+		dir := filepath.Dir(file)
+		namer, ok := namers[dir]
+		if !ok {
+			namer, err = naming.NewNamer(dir, opts.collision)
+			if err != nil {
+				slog.Error("Error reading input dir", "error", err)
+				return
+			}
+			namers[dir] = namer
+		}
+		data, err := enc.GetMetadata(ctx, file)
 		if err != nil {
 			slog.Error("Error getting audio title", "error", err)
 			return
 		}
-		slog.Info("Audio title", "title", audioTitle)
-		base := filepath.Base(file)
-		ext := filepath.Ext(base)
-		base = base[:len(base)-len(ext)]
-		outFile := filepath.Join(inDir, audioTitle+".mp4")
-		if st, err := os.Stat(outFile); err == nil && st.Size() > 0 {
+		slog.Info("Audio title", "title", data.Tag("title"))
+		outFile, ok, err := namer.Name(file, data)
+		if err != nil {
+			slog.Error("Error naming file", "file", file, "error", err)
+			return
+		}
+		if !ok {
+			slog.Info("Skipping, title is taken", "file", file)
+			if p != nil {
+				p.Add(plan.Action{Kind: plan.KindSkip, Source: file, Detail: "title is taken"})
+			}
+			continue
+		}
+		if p != nil {
+			if outFile != file {
+				p.Add(plan.Action{Kind: plan.KindRename, Source: file, Target: outFile})
+			}
+			continue
+		}
+		tags := func(t *state.Track) {
+			t.Title = data.Tag("title")
+			t.Artist = data.Tag("artist")
+		}
+		if outFile == file {
+			_, err = db.Source(file, tags)
+			if err != nil {
+				slog.Warn("Error recording state", "file", file, "error", err)
+			}
 			slog.Info("Skipping", "file", file)
 			continue
 		}
-		err = os.Rename(file, outFile)
+		// The journal hashes the file anyway, so the state doesn't have to
+		hash, err := j.Rename(file, outFile)
 		if err != nil {
 			slog.Error("Error renaming file", "error", err)
 			return
 		}
+		_, err = db.Update(hash, func(t *state.Track) {
+			if t.OriginalName == "" {
+				t.OriginalName = filepath.Base(file)
+			}
+			tags(t)
+			t.Path, _ = filepath.Abs(outFile)
+			t.RenamedAt = time.Now()
+		})
+		if err != nil {
+			slog.Warn("Error recording state", "file", outFile, "error", err)
+		}
+	}
+}
+
+type convertOptions struct {
+	collision  string
+	audio      encoder.AudioTarget
+	video      encoder.VideoTarget
+	coverFrame time.Duration
+	workers    int
+	verify     bool
+	scan       scanFlags
+	// bars is nil unless progress bars are shown
+	bars *progressBars
+	// db records finished outputs; nil records nothing
+	db *state.DB
+}
+
+func (o convertOptions) scheduler() *encoder.Scheduler {
+	opts := []encoder.SchedulerOption{encoder.WithWorkers(o.workers)}
+	if o.bars != nil {
+		opts = append(opts, encoder.WithJobDone(o.bars.JobDone))
+	}
+	return encoder.NewScheduler(opts...)
+}
+
+func (o convertOptions) encoder() *encoder.Encoder {
+	opts := []encoder.EncoderOption{
+		encoder.WithAudioTarget(o.audio),
+		encoder.WithVideoTarget(o.video),
+		encoder.WithCoverFrame(o.coverFrame),
+		encoder.WithVerify(o.verify),
+	}
+	if o.bars != nil {
+		opts = append(opts, encoder.WithProgress(o.bars.Update))
+	}
+	return encoder.NewEncoder(opts...)
+}
+
+// runJobs runs a batch of conversions, showing progress if asked to
+func (o convertOptions) runJobs(ctx context.Context, jobs []encoder.Job) error {
+	o.bars.Start(len(jobs))
+	results, err := o.scheduler().Run(ctx, jobs)
+	o.bars.Finish()
+	logSummary(results)
+	return err
+}
+
+// convertFlags parses the flags of input, audio, input-audio and video.
+// Renaming flags only apply to commands that rename, encoding flags to ones
+// that encode.
+func convertFlags(name string, args []string) (convertOptions, []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	opts := convertOptions{audio: encoder.DefaultAudioTarget, video: encoder.DefaultVideoTarget}
+	if name == "input" || name == "input-audio" {
+		fs.StringVar(&opts.collision, "collision", naming.CollisionCounter, "What to do when two files have the same title: counter, artist, version or skip")
+	}
+	if name == "audio" || name == "input-audio" {
+		fs.StringVar(&opts.audio.Codec, "audio", opts.audio.Codec, "Format to transcode audio to when it can't be copied: aac, alac, flac or aiff")
+		fs.StringVar(&opts.audio.Bitrate, "bitrate", opts.audio.Bitrate, "Bitrate when transcoding to aac")
+		fs.DurationVar(&opts.coverFrame, "cover-frame", opts.coverFrame, "Use the video frame at this time (like 30s) as cover art when a file has none")
+	}
+	if name == "video" {
+		fs.StringVar(&opts.video.Format, "format", opts.video.Format, "HAP flavour: hap, hap_q (higher quality) or hap_alpha")
+		fs.IntVar(&opts.video.Width, "width", 0, "Resize to this width; keeps the aspect ratio if -height isn't set")
+		fs.IntVar(&opts.video.Height, "height", 0, "Resize to this height; keeps the aspect ratio if -width isn't set")
+		fs.Float64Var(&opts.video.FPS, "fps", 0, "Change the frame rate, 0 to keep it")
+	}
+	opts.scan.register(fs)
+	progress := false
+	if name != "input" {
+		fs.IntVar(&opts.workers, "j", runtime.NumCPU(), "Number of files to encode at once")
+		fs.BoolVar(&progress, "progress", isTerminal(os.Stderr), "Show progress bars")
+		fs.BoolVar(&opts.verify, "verify", false, "Encode existing outputs again if they are truncated")
 	}
+	fs.Parse(args)
+	if err := opts.audio.Validate(); err != nil {
+		slog.Error("Invalid audio format", "error", err)
+		os.Exit(1)
+	}
+	if err := opts.video.Validate(); err != nil {
+		slog.Error("Invalid video format", "error", err)
+		os.Exit(1)
+	}
+	if progress {
+		opts.bars = newProgressBars(os.Stderr)
+	}
+	return opts, fs.Args()
+}
+
+// convertUndo puts back the names convertInputs replaced, newest first
+func convertUndo(ctx context.Context, p *plan.Plan, args []string) {
+	fs := flag.NewFlagSet("undo", flag.ExitOnError)
+	last := fs.Int("last", 0, "Only undo the last N renames, 0 for all of them")
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) < 1 {
+		slog.Error("No input dir specified specified")
+		return
+	}
+	inDir := args[0]
+
+	entries, err := journal.Read(inDir)
+	if err != nil {
+		slog.Error("Error reading journal", "error", err)
+		return
+	}
+	if len(entries) == 0 {
+		slog.Info("Nothing to undo", "dir", inDir)
+		return
+	}
+	start := 0
+	if *last > 0 && *last < len(entries) {
+		start = len(entries) - *last
+	}
+
+	// Entries that fail stay in the journal so they can be retried
+	keep := entries[:start:start]
+	var failed []journal.Entry
+	undone := 0
+	for i := len(entries) - 1; i >= start; i-- {
+		e := entries[i]
+		if ctx.Err() != nil {
+			failed = append(failed, e)
+			continue
+		}
+		if p != nil {
+			p.Add(plan.Action{Kind: plan.KindRename, Source: e.Renamed, Target: e.Original, Detail: "undo"})
+			continue
+		}
+		err := journal.Undo(e)
+		if err != nil {
+			slog.Error("Error undoing rename", "file", e.Renamed, "error", err)
+			failed = append(failed, e)
+			continue
+		}
+		undone++
+	}
+	if p != nil {
+		return
+	}
+	slices.Reverse(failed)
+	err = journal.Write(inDir, append(keep, failed...))
+	if err != nil {
+		slog.Error("Error writing journal", "error", err)
+	}
+	slog.Info("Undid renames", "undone", undone, "failed", len(failed))
 }
 
 // func correctAudioVideos(ctx context.Context, matched []string, audioOutDir, videoOutDir string) ([]string, error) {
@@ -326,138 +976,175 @@ func convertInputs(ctx context.Context, inDir string) {
 //		return correct, nil
 //	}
 
-func convertAddToResolume(ctx context.Context, r *resolume.Resolume, file string, layer int) error {
+func convertAudioFiles(ctx context.Context, opts convertOptions, inDir, outDir string, p *plan.Plan) error {
+	enc := opts.encoder()
 
-	exists, err := clipExists(ctx, r, file)
+	files, err := opts.scan.scan(ctx, inDir)
 	if err != nil {
-		slog.Error("Error checking if clip exists", "error", err)
+		slog.Error("Error scanning files", "error", err)
 		return err
 	}
-	if exists {
-		slog.Info("Clip already exists", "clip", file)
-		return nil
-	}
+	var jobs []encoder.Job
+	for _, file := range files {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+		fname := file.Path
+		if p != nil {
+			// Nothing was renamed, so use the name it would have had
+			fname = p.Renamed(fname)
+		}
+		outFile := renamedFile(file, fname).OutPath(outDir, enc.AudioExt())
 
-	_, clip, err := r.FindEmptyClip(ctx, layer, layer)
-	if err != nil {
-		slog.Error("Error finding empty clip", "error", err)
-		return err
-	}
-	err = r.OpenClip(ctx, clip.Id, file)
-	if err != nil {
-		slog.Error("Error opening clip", "error", err)
-		return err
+		if p != nil {
+			if encoder.OutputExists(outFile) {
+				p.Add(plan.Action{Kind: plan.KindSkip, Source: fname, Target: outFile, Detail: "already encoded"})
+				continue
+			}
+			// The file hasn't been renamed, so probe it under its current name
+			detail := ""
+			data, err := enc.GetMetadata(ctx, file.Path)
+			if err == nil {
+				var ap encoder.AudioPlan
+				ap, err = enc.PlanAudio(data)
+				detail = ap.String()
+			}
+			if err != nil {
+				detail = err.Error()
+			}
+			p.Add(plan.Action{Kind: plan.KindEncode, Source: fname, Target: outFile, Detail: detail})
+			continue
+		}
+		jobs = append(jobs, encoder.Job{
+			Name: fname,
+			Run: func(ctx context.Context) error {
+				slog.Info("Converting", "file", fname)
+				err := os.MkdirAll(filepath.Dir(outFile), 0o755)
+				if err != nil {
+					return err
+				}
+				err = enc.Encode(ctx, fname, outFile)
+				if err == nil || errors.Is(err, encoder.ErrOutputExists) {
+					opts.recordOutput(fname, func(t *state.Track) {
+						t.Audio, _ = filepath.Abs(outFile)
+						t.AudioAt = outputTime(outFile)
+					})
+				}
+				return err
+			},
+		})
 	}
-
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-time.After(1 * time.Second):
-	}
-	val := make(map[string]any)
-	// val["name"] = struct {
-	// 	Valuetype string `json:"valuetype"`
-	// 	Id        int    `json:"id"`
-	// 	Value     string `json:"value"`
-	// }{
-	// 	Valuetype: "ParamString",
-	// 	Id:        clip.Name.Id,
-	// 	Value:     audioTitle,
-	// }
-	val["target"] = struct {
-		// Id        any    `json:"id"`
-		ValueType string `json:"valuetype"`
-		Value     string `json:"value"`
-		Index     int    `json:"index"`
-		// Options   any    `json:"options"`
-	}{
-		// Id:        clip.Target["id"],
-		ValueType: "ParamChoice",
-		Value:     "Denon Player Determined",
-		Index:     4,
-		// Options:   clip.Target["options"],
-	}
-	val["transporttype"] = struct {
-		// 	Id        int    `json:"id"`
-		ValueType string `json:"valuetype"`
-		Value     string `json:"value"`
-		Index     int    `json:"index"`
-	}{
-		// 	Id:        rand.Intn(1000000),
-		ValueType: "ParamChoice",
-		Value:     "Denon DJ",
-		Index:     4,
-	}
-	err = r.SetClipRaw(ctx, clip.Id, val)
-	if err != nil {
-		slog.Error("Error setting clip", "error", err)
-		return err
+	if p != nil {
+		return nil
 	}
-	return nil
 
+	return opts.runJobs(ctx, jobs)
 }
 
-func clipExists(ctx context.Context, r *resolume.Resolume, videoFile string) (bool, error) {
-	comp, err := r.GetComposition(ctx)
+// recordOutput saves an output of source in the state database
+func (o convertOptions) recordOutput(source string, fn func(*state.Track)) {
+	_, err := o.db.Source(source, fn)
 	if err != nil {
-		slog.Error("Error getting composition", "error", err)
-		return false, err
+		slog.Warn("Error recording state", "file", source, "error", err)
 	}
+}
 
-	for _, layer := range comp.Layers {
-		for _, clip := range layer.Clips {
-			if clip.Video.FileInfo.Path == videoFile {
-				return true, nil
-			}
-		}
+// outputTime is when an output was written, so skipped outputs keep the time
+// they were made rather than the time they were last seen
+func outputTime(outFile string) time.Time {
+	st, err := os.Stat(outFile)
+	if err != nil {
+		return time.Now()
 	}
-	return false, nil
+	return st.ModTime()
 }
 
-func getAudioTitle(ctx context.Context, enc *encoder.Encoder, audioFile string) (string, error) {
+// renamedFile is file as it would be called after being renamed to fname,
+// which is in the same folder
+func renamedFile(file library.File, fname string) library.File {
+	file.Path = fname
+	file.Rel = path.Join(path.Dir(file.Rel), filepath.Base(fname))
+	return file
+}
 
-	ff, err := enc.GetAudioTitle(ctx, audioFile)
-	if err != nil {
-		slog.Error("Error getting audio title", "error", err)
-		return "", err
+// logSummary reports how a batch of conversions went, listing the failures
+// again so they aren't lost in the log
+func logSummary(results []encoder.JobResult) {
+	sum := encoder.Summarize(results)
+	slog.Info("Summary", "converted", sum.Converted, "skipped", sum.Skipped, "failed", sum.Failed, "canceled", sum.Canceled)
+	// The scheduler logged why as each one failed
+	var failed []string
+	for _, res := range results {
+		if res.Status == encoder.JobFailed {
+			failed = append(failed, res.Name)
+		}
+	}
+	if len(failed) > 0 {
+		slog.Error("Failed", "files", failed)
 	}
-
-	return ff, nil
 }
 
-func convertAudioFiles(ctx context.Context, enc *encoder.Encoder, inDir, outDir string) error {
+// convertVideo encodes every video in inDir to HAP in outDir, in place of
+// running them through Alley
+func convertVideo(ctx context.Context, db *state.DB, p *plan.Plan, args []string) {
+	opts, args := convertFlags("video", args)
+	opts.db = db
+	if len(args) < 2 {
+		slog.Error("No input dir specified specified")
+		return
+	}
+	inDir := args[0]
+	outDir := args[1]
 
-	files, err := os.ReadDir(inDir)
+	files, err := opts.scan.scan(ctx, inDir)
 	if err != nil {
-		slog.Error("Error reading directory", "error", err)
-		return err
+		slog.Error("Error scanning files", "error", err)
+		return
 	}
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		if file.Name()[0] == '.' {
-			continue
+	enc := opts.encoder()
+	var jobs []encoder.Job
+	for _, f := range files {
+		if ctx.Err() != nil {
+			return
 		}
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
+		file := f.Path
+		fname := file
+		if p != nil {
+			fname = p.Renamed(fname)
 		}
-		fname := filepath.Join(inDir, file.Name())
+		outFile := renamedFile(f, fname).OutPath(outDir, enc.VideoExt())
 
-		slog.Info("Converting", "file", fname)
-		basename := filepath.Base(fname)
-		ext := filepath.Ext(basename)
-		basename = basename[:len(basename)-len(ext)]
-		outFile := filepath.Join(outDir, basename+".m4a")
-
-		err := enc.Encode(ctx, fname, outFile)
-		if err != nil {
-			slog.Error("Error converting", "error", err)
-			return err
+		if p != nil {
+			if encoder.OutputExists(outFile) {
+				p.Add(plan.Action{Kind: plan.KindSkip, Source: fname, Target: outFile, Detail: "already encoded"})
+			} else {
+				p.Add(plan.Action{Kind: plan.KindEncode, Source: fname, Target: outFile, Detail: opts.video.Format})
+			}
+			continue
 		}
+		jobs = append(jobs, encoder.Job{
+			Name: file,
+			Run: func(ctx context.Context) error {
+				err := os.MkdirAll(filepath.Dir(outFile), 0o755)
+				if err != nil {
+					return err
+				}
+				err = enc.EncodeVideo(ctx, file, outFile)
+				if err == nil || errors.Is(err, encoder.ErrOutputExists) {
+					opts.recordOutput(file, func(t *state.Track) {
+						t.Video, _ = filepath.Abs(outFile)
+						t.VideoAt = outputTime(outFile)
+					})
+				}
+				return err
+			},
+		})
 	}
-
-	return nil
+	if p != nil {
+		return
+	}
+	// Failures are logged as they happen
+	opts.runJobs(ctx, jobs)
 }
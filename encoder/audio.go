@@ -0,0 +1,136 @@
+package encoder
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	AudioAAC  = "aac"
+	AudioALAC = "alac"
+	AudioFLAC = "flac"
+	AudioAIFF = "aiff"
+)
+
+// AudioTarget is the format audio is extracted to when the source audio
+// can't be copied as is
+type AudioTarget struct {
+	Codec string
+	// Bitrate is passed to ffmpeg as is, like "256k". Only AAC uses it.
+	Bitrate string
+}
+
+var DefaultAudioTarget = AudioTarget{Codec: AudioAAC, Bitrate: "256k"}
+
+// Validate checks the codec is one we know how to write
+func (t AudioTarget) Validate() error {
+	switch t.Codec {
+	case AudioAAC, AudioALAC, AudioFLAC, AudioAIFF:
+		return nil
+	}
+	return fmt.Errorf("unknown audio format %q, use aac, alac, flac or aiff", t.Codec)
+}
+
+// Ext is the extension of the files written, without the dot
+func (t AudioTarget) Ext() string {
+	switch t.Codec {
+	case AudioFLAC:
+		return "flac"
+	case AudioAIFF:
+		return "aiff"
+	}
+	return "m4a"
+}
+
+// CanCopy reports whether audio in codec can go into the target's container
+// without transcoding. codec is the ffprobe codec name.
+func (t AudioTarget) CanCopy(codec string) bool {
+	var copyable []string
+	switch t.Codec {
+	case AudioAAC, AudioALAC:
+		copyable = []string{"aac", "alac"}
+	case AudioFLAC:
+		copyable = []string{"flac"}
+	case AudioAIFF:
+		copyable = []string{"pcm_s16be", "pcm_s24be"}
+	}
+	return slices.Contains(copyable, codec)
+}
+
+func (t AudioTarget) String() string {
+	if t.Codec == AudioAAC && t.Bitrate != "" {
+		return t.Codec + " " + t.Bitrate
+	}
+	return t.Codec
+}
+
+// codecArgs are the ffmpeg arguments that transcode to the target
+func (t AudioTarget) codecArgs() []string {
+	switch t.Codec {
+	case AudioALAC:
+		return []string{"-c:a", "alac"}
+	case AudioFLAC:
+		return []string{"-c:a", "flac"}
+	case AudioAIFF:
+		return []string{"-c:a", "pcm_s16be"}
+	}
+	args := []string{"-c:a", "aac"}
+	if t.Bitrate != "" {
+		args = append(args, "-b:a", t.Bitrate)
+	}
+	return args
+}
+
+// muxerArgs are the ffmpeg arguments the target's container needs, whether
+// the audio is copied or transcoded
+func (t AudioTarget) muxerArgs() []string {
+	if t.Codec == AudioAIFF {
+		// AIFF only keeps tags and cover art in an ID3 chunk
+		return []string{"-write_id3v2", "1"}
+	}
+	return nil
+}
+
+// AudioPlan is how the audio of a file will be extracted
+type AudioPlan struct {
+	// Codec is the codec of the source audio
+	Codec string
+	// Copy is set when the audio is copied rather than transcoded
+	Copy   bool
+	Target AudioTarget
+}
+
+// args are the ffmpeg arguments that write the audio as planned
+func (p AudioPlan) args() []string {
+	args := []string{"-c:a", "copy"}
+	if !p.Copy {
+		args = p.Target.codecArgs()
+	}
+	return append(args, p.Target.muxerArgs()...)
+}
+
+func (p AudioPlan) String() string {
+	if p.Copy {
+		return "copy " + p.Codec
+	}
+	return fmt.Sprintf("transcode %s to %s", p.Codec, p.Target)
+}
+
+// PlanAudio decides whether the first audio stream can be copied
+func (e Encoder) PlanAudio(m Metadata) (AudioPlan, error) {
+	streams := m.AudioStreams()
+	if len(streams) == 0 {
+		return AudioPlan{}, fmt.Errorf("no audio stream")
+	}
+	codec := streams[0].CodecName
+	return AudioPlan{
+		Codec:  codec,
+		Copy:   e.audio.CanCopy(codec),
+		Target: e.audio,
+	}, nil
+}
+
+// AudioExt is the extension Encode expects its output files to have
+func (e Encoder) AudioExt() string {
+	return e.audio.Ext()
+}
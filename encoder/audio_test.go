@@ -0,0 +1,41 @@
+package encoder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAudioPlanArgs(t *testing.T) {
+	aac := DefaultAudioTarget
+	aiff := AudioTarget{Codec: AudioAIFF}
+	tests := []struct {
+		codec  string
+		target AudioTarget
+		copy   bool
+		want   []string
+	}{
+		{"aac", aac, true, []string{"-c:a", "copy"}},
+		{"mp3", aac, false, []string{"-c:a", "aac", "-b:a", "256k"}},
+		{"alac", AudioTarget{Codec: AudioALAC}, true, []string{"-c:a", "copy"}},
+		{"aac", AudioTarget{Codec: AudioALAC}, true, []string{"-c:a", "copy"}},
+		{"mp3", AudioTarget{Codec: AudioALAC}, false, []string{"-c:a", "alac"}},
+		{"mp3", AudioTarget{Codec: AudioFLAC}, false, []string{"-c:a", "flac"}},
+		// AIFF needs its ID3 chunk for tags and cover art, copied or not
+		{"pcm_s16be", aiff, true, []string{"-c:a", "copy", "-write_id3v2", "1"}},
+		{"pcm_s24be", aiff, true, []string{"-c:a", "copy", "-write_id3v2", "1"}},
+		{"aac", aiff, false, []string{"-c:a", "pcm_s16be", "-write_id3v2", "1"}},
+	}
+	for _, tt := range tests {
+		e := NewEncoder(WithAudioTarget(tt.target))
+		p, err := e.PlanAudio(Metadata{Streams: []Stream{{CodecType: CodecTypeAudio, CodecName: tt.codec}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Copy != tt.copy {
+			t.Errorf("%s to %s: copy is %v", tt.codec, tt.target, p.Copy)
+		}
+		if got := p.args(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s to %s: got args %q, want %q", tt.codec, tt.target, got, tt.want)
+		}
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"log/slog"
 )
@@ -14,6 +17,14 @@ import (
 type Encoder struct {
 	stdout io.Writer
 	stderr io.Writer
+	audio  AudioTarget
+	video  VideoTarget
+	// coverFrame is where to grab cover art from the video, for files without
+	// any. Zero means don't; the first frame is usually black anyway.
+	coverFrame time.Duration
+	progress   func(Progress)
+	verify     bool
+	tolerance  time.Duration
 }
 
 type EncoderOption func(*Encoder)
@@ -30,28 +41,105 @@ func WithStderr(w io.Writer) EncoderOption {
 	}
 }
 
+// WithAudioTarget sets what audio is transcoded to when it can't be copied
+func WithAudioTarget(t AudioTarget) EncoderOption {
+	return func(e *Encoder) {
+		e.audio = t
+	}
+}
+
+// WithCoverFrame uses the video frame at d as cover art when a file has none
+func WithCoverFrame(d time.Duration) EncoderOption {
+	return func(e *Encoder) {
+		e.coverFrame = d
+	}
+}
+
 func NewEncoder(opts ...EncoderOption) *Encoder {
-	e := &Encoder{}
+	e := &Encoder{audio: DefaultAudioTarget, video: DefaultVideoTarget, tolerance: time.Second}
 	for _, opt := range opts {
 		opt(e)
 	}
 	return e
 }
 
+// Encode extracts the audio of inFile. Audio the target's container can hold
+// is copied, anything else is transcoded to the target. outFile should have
+// the extension from AudioExt. Tags and cover art are carried over, and
+// checked before the file is moved into place, so outFile is never left
+// half written. If outFile already exists and is complete it returns
+// ErrOutputExists.
 func (e Encoder) Encode(ctx context.Context, inFile, outFile string) error {
 
 	// basename := filepath.Base(inFile)
 	// ext := filepath.Ext(basename)
 	// basename = basename[:len(basename)-len(ext)]
 	// outFile := filepath.Join(outDir, basename+".m4a")
-	if st, err := os.Stat(outFile); err == nil && st.Size() > 0 {
-		slog.Info("Skipping", "file", inFile)
-		return nil
+	data, err := e.GetMetadata(ctx, inFile)
+	if err != nil {
+		return err
 	}
-	cmd := exec.CommandContext(ctx, "ffmpeg", "-i", inFile, "-vn", "-acodec", "copy", outFile)
-	cmd.Stdout = e.stdout
-	cmd.Stderr = e.stderr
-	return cmd.Run()
+	if OutputExists(outFile) {
+		err := e.existing(ctx, data, inFile, outFile, CodecTypeAudio)
+		if err != nil {
+			return err
+		}
+	}
+	// Engine sends the title tag and Resolume matches it against the video's
+	// file name, so the title has to be the file name, even if the name had
+	// to be cleaned up or made unique
+	title := filepath.Base(outFile)
+	title = title[:len(title)-len(filepath.Ext(title))]
+
+	plan, err := e.PlanAudio(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", inFile, err)
+	}
+	args := []string{"-i", inFile}
+	cover, hasCover := data.CoverArt()
+	frameCover := !hasCover && e.coverFrame > 0 && hasVideo(data)
+	if frameCover {
+		at := e.coverFrame
+		// Past the end there's no frame to take, so use the middle instead
+		if d := data.Duration(); d > 0 && at >= d {
+			at = d / 2
+		}
+		args = append(args, "-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64), "-i", inFile)
+	}
+	args = append(args, "-map", "0:a:0", "-map_metadata", "0")
+	if plan.Copy {
+		slog.Info("Copying audio", "file", inFile, "codec", plan.Codec)
+	} else {
+		slog.Info("Transcoding audio", "file", inFile, "codec", plan.Codec, "target", plan.Target.String())
+	}
+	args = append(args, plan.args()...)
+	switch {
+	case hasCover:
+		args = append(args, "-map", fmt.Sprintf("0:%d", cover.Index), "-c:v", "copy", "-disposition:v:0", "attached_pic")
+	case frameCover:
+		slog.Info("Using a video frame as cover art", "file", inFile, "at", e.coverFrame)
+		args = append(args, "-map", "1:v:0", "-frames:v", "1", "-filter:v", "scale='min(1000,iw)':-2",
+			"-c:v", "mjpeg", "-disposition:v:0", "attached_pic")
+	}
+	partial := partialPath(outFile)
+	args = append(args, "-metadata", "title="+title, "-y", partial)
+	err = e.ffmpeg(ctx, inFile, data.Duration(), args...)
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+
+	err = e.verifyTags(ctx, data, partial, title, hasCover || frameCover)
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return commit(partial, outFile)
+}
+
+func hasVideo(m Metadata) bool {
+	_, ok := m.VideoStream()
+	return ok
 }
 
 func (e Encoder) GetThumbnail(ctx context.Context, inFile string) (io.ReadCloser, error) {
@@ -70,38 +158,8 @@ func (e Encoder) GetThumbnail(ctx context.Context, inFile string) (io.ReadCloser
 
 }
 
-func (e Encoder) GetAudioTitle(ctx context.Context, inFile string) (string, error) {
-	data, err := e.GetMetadata(ctx, inFile)
-	if err != nil {
-		return "", err
-	}
-	if data.Format.Tags == nil {
-		return "", fmt.Errorf("no tags")
-	}
-	title, ok := data.Format.Tags["title"]
-	if !ok {
-		return "", fmt.Errorf("no title")
-	}
-	// artist, ok := data.Format.Tags["artist"]
-	// if ok {
-	// 	return fmt.Sprintf("%s - %s", artist, title), nil
-	// }
-	return title, nil
-}
-
-type ffmetadata struct {
-	Streams []ffstream `json:"streams"`
-	Format  ffformat   `json:"format"`
-}
-
-type ffstream struct {
-}
-type ffformat struct {
-	Filename string            `json:"filename"`
-	Tags     map[string]string `json:"tags"`
-}
-
-func (e Encoder) GetMetadata(ctx context.Context, inFile string) (ffmetadata, error) {
+// GetMetadata runs ffprobe on inFile
+func (e Encoder) GetMetadata(ctx context.Context, inFile string) (Metadata, error) {
 
 	// ffprobe -show_format -show_streams -output_format json -i input.mp4
 
@@ -111,26 +169,26 @@ func (e Encoder) GetMetadata(ctx context.Context, inFile string) (ffmetadata, er
 	cmd.Stderr = e.stderr
 	pipe, err := cmd.StdoutPipe()
 	if err != nil {
-		return ffmetadata{}, err
+		return Metadata{}, err
 	}
-	data := ffmetadata{}
+	data := Metadata{}
 	dec := json.NewDecoder(pipe)
 	err = cmd.Start()
 	if err != nil {
-		return ffmetadata{}, err
+		return Metadata{}, err
 	}
 
 	err = dec.Decode(&data)
 	if err != nil {
-		return ffmetadata{}, err
+		cmd.Wait()
+		return Metadata{}, err
+	}
+	err = cmd.Wait()
+	if err != nil {
+		return Metadata{}, fmt.Errorf("ffprobe %s: %w", inFile, err)
 	}
 	return data, nil
 }
 
 // encode audio
 //         ffmpeg -i "$i" -vn -acodec copy "$ofname"
-
-//encode video (stripping)
-//     #     ffmpeg -i "$i" -an -vcodec copy "$ofvideo"
-
-// encode video (DXV3)
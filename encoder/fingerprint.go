@@ -0,0 +1,188 @@
+package encoder
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"math/cmplx"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Fingerprints work the way Chromaprint's do: the audio is cut into short
+// overlapping frames, each frame's spectrum into bands, and each bit says
+// whether the energy difference between two neighbouring bands went up or
+// down since the last frame. That survives transcoding and volume changes,
+// but not a different recording.
+const (
+	printRate   = 11025
+	printFrame  = 4096
+	printHop    = printFrame / 3
+	printBands  = 33
+	printLowHz  = 300
+	printHighHz = 5000
+	// printLength is how much audio is fingerprinted, from the start
+	printLength = 2 * time.Minute
+)
+
+// Fingerprint is one 32 bit word per frame of audio
+type Fingerprint []uint32
+
+// Fingerprint decodes the first two minutes of inFile's audio and
+// fingerprints it
+func (e Encoder) Fingerprint(ctx context.Context, inFile string) (Fingerprint, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-i", inFile,
+		"-map", "0:a:0",
+		"-t", strconv.FormatFloat(printLength.Seconds(), 'f', -1, 64),
+		"-ac", "1",
+		"-ar", strconv.Itoa(printRate),
+		"-f", "s16le",
+		"pipe:1",
+	)
+	cmd.Stderr = e.stderr
+	pipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	samples, readErr := readSamples(bufio.NewReader(pipe))
+	err = cmd.Wait()
+	if err != nil {
+		return nil, fmt.Errorf("decoding audio of %s: %w", inFile, err)
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	if len(samples) < printFrame*2 {
+		return nil, fmt.Errorf("%s is too short to fingerprint", inFile)
+	}
+	return fingerprint(samples), nil
+}
+
+func readSamples(r io.Reader) ([]float64, error) {
+	var samples []float64
+	buf := make([]byte, 2)
+	for {
+		_, err := io.ReadFull(r, buf)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return samples, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, float64(int16(binary.LittleEndian.Uint16(buf))))
+	}
+}
+
+func fingerprint(samples []float64) Fingerprint {
+	edges := bandEdges()
+	window := make([]float64, printFrame)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(printFrame-1))
+	}
+	var print Fingerprint
+	var prev []float64
+	frame := make([]complex128, printFrame)
+	for start := 0; start+printFrame <= len(samples); start += printHop {
+		for i := range frame {
+			frame[i] = complex(samples[start+i]*window[i], 0)
+		}
+		fft(frame)
+		energy := make([]float64, printBands)
+		for b := 0; b < printBands; b++ {
+			for k := edges[b]; k < edges[b+1]; k++ {
+				energy[b] += real(frame[k])*real(frame[k]) + imag(frame[k])*imag(frame[k])
+			}
+			energy[b] = math.Log1p(energy[b])
+		}
+		if prev != nil {
+			var word uint32
+			for b := 0; b < printBands-1; b++ {
+				if (energy[b]-energy[b+1])-(prev[b]-prev[b+1]) > 0 {
+					word |= 1 << b
+				}
+			}
+			print = append(print, word)
+		}
+		prev = energy
+	}
+	return print
+}
+
+// bandEdges are the FFT bins the bands start at, spaced evenly on a log
+// scale the way pitch is
+func bandEdges() []int {
+	edges := make([]int, printBands+1)
+	ratio := math.Pow(float64(printHighHz)/printLowHz, 1/float64(printBands))
+	for i := range edges {
+		hz := printLowHz * math.Pow(ratio, float64(i))
+		edges[i] = int(hz * printFrame / printRate)
+	}
+	for i := 1; i < len(edges); i++ {
+		edges[i] = max(edges[i], edges[i-1]+1)
+	}
+	return edges
+}
+
+// fft is an in place radix 2 FFT; len(x) must be a power of two
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
+
+// maxPrintOffset is how many frames two fingerprints may be shifted by, for
+// audio that starts a little later in one file than the other
+const maxPrintOffset = 16
+
+// Similarity is how alike two fingerprints are, from 0.5 for unrelated audio
+// to 1 for the same audio. The best alignment within a second or two wins.
+func Similarity(a, b Fingerprint) float64 {
+	best := 0.0
+	for off := -maxPrintOffset; off <= maxPrintOffset; off++ {
+		same, total := 0, 0
+		for i := range a {
+			j := i + off
+			if j < 0 || j >= len(b) {
+				continue
+			}
+			same += 32 - bits.OnesCount32(a[i]^b[j])
+			total += 32
+		}
+		// Too little overlap says nothing
+		if total < 32*maxPrintOffset*2 {
+			continue
+		}
+		best = max(best, float64(same)/float64(total))
+	}
+	return best
+}
@@ -0,0 +1,138 @@
+package encoder
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestFFT(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	const n = 64
+	x := make([]complex128, n)
+	for i := range x {
+		x[i] = complex(rng.Float64()*2-1, rng.Float64()*2-1)
+	}
+	// Check against the DFT, worked out the slow way
+	want := make([]complex128, n)
+	for k := range want {
+		for j, v := range x {
+			want[k] += v * cmplx.Exp(complex(0, -2*math.Pi*float64(j*k)/n))
+		}
+	}
+	fft(x)
+	for k := range x {
+		if cmplx.Abs(x[k]-want[k]) > 1e-9 {
+			t.Errorf("bin %d is %v, want %v", k, x[k], want[k])
+		}
+	}
+}
+
+func TestFFTCosine(t *testing.T) {
+	const n, bin = 256, 10
+	x := make([]complex128, n)
+	for i := range x {
+		x[i] = complex(math.Cos(2*math.Pi*bin*float64(i)/n), 0)
+	}
+	fft(x)
+	for k, v := range x {
+		want := 0.0
+		if k == bin || k == n-bin {
+			want = n / 2
+		}
+		if math.Abs(cmplx.Abs(v)-want) > 1e-9 {
+			t.Errorf("bin %d has magnitude %f, want %f", k, cmplx.Abs(v), want)
+		}
+	}
+}
+
+func TestBandEdges(t *testing.T) {
+	edges := bandEdges()
+	if len(edges) != printBands+1 {
+		t.Fatalf("got %d edges, want %d", len(edges), printBands+1)
+	}
+	for i := 1; i < len(edges); i++ {
+		if edges[i] <= edges[i-1] {
+			t.Errorf("edge %d is %d, not above %d", i, edges[i], edges[i-1])
+		}
+	}
+	if hz := edges[0] * printRate / printFrame; hz < printLowHz-10 || hz > printLowHz {
+		t.Errorf("bands start at %d Hz", hz)
+	}
+	if last := edges[printBands]; last > printFrame/2 {
+		t.Errorf("bands end at bin %d, past the middle of the spectrum", last)
+	}
+}
+
+// track makes seconds of audio that changes like music does: a mix of tones
+// whose loudness changes every fraction of a second, over a little noise
+func track(seed uint64, seconds float64) []float64 {
+	rng := rand.New(rand.NewPCG(seed, 0))
+	n := int(seconds * printRate)
+	samples := make([]float64, n)
+	const tones, note = 24, printRate / 5
+	freqs := make([]float64, tones)
+	for i := range freqs {
+		freqs[i] = printLowHz * math.Pow(float64(printHighHz)/printLowHz, rng.Float64())
+	}
+	amps := make([]float64, tones)
+	for i := range samples {
+		if i%note == 0 {
+			for k := range amps {
+				amps[k] = rng.Float64() * rng.Float64()
+			}
+		}
+		v := rng.NormFloat64() * 0.05
+		for k, f := range freqs {
+			v += amps[k] * math.Sin(2*math.Pi*f*float64(i)/printRate)
+		}
+		samples[i] = v * 1000
+	}
+	return samples
+}
+
+func TestSimilarity(t *testing.T) {
+	song := track(1, 30)
+	print := fingerprint(song)
+	if len(print) == 0 {
+		t.Fatal("empty fingerprint")
+	}
+
+	// The same audio, starting a third of a second late and quieter
+	shift := printRate / 3
+	quieter := make([]float64, len(song)-shift)
+	for i := range quieter {
+		quieter[i] = song[i+shift] * 0.3
+	}
+	noise := make([]float64, len(song))
+	rng := rand.New(rand.NewPCG(3, 4))
+	for i := range noise {
+		noise[i] = rng.NormFloat64() * 1000
+	}
+
+	same := Similarity(print, print)
+	shifted := Similarity(print, fingerprint(quieter))
+	other := Similarity(print, fingerprint(track(2, 30)))
+	noisy := Similarity(print, fingerprint(noise))
+	t.Logf("same %.3f shifted %.3f other %.3f noise %.3f", same, shifted, other, noisy)
+
+	if same != 1 {
+		t.Errorf("a fingerprint is %.3f like itself, want 1", same)
+	}
+	if shifted < 0.75 {
+		t.Errorf("shifted and quieter audio is only %.3f alike", shifted)
+	}
+	for name, s := range map[string]float64{"another track": other, "noise": noisy} {
+		if s > 0.65 {
+			t.Errorf("%s is %.3f alike, want near 0.5", name, s)
+		}
+	}
+}
+
+func TestSimilarityTooShort(t *testing.T) {
+	a := Fingerprint{1, 2, 3}
+	if s := Similarity(a, a); s != 0 {
+		t.Errorf("got %f for fingerprints too short to compare, want 0", s)
+	}
+}
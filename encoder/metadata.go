@@ -0,0 +1,191 @@
+package encoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CodecTypeAudio    = "audio"
+	CodecTypeVideo    = "video"
+	CodecTypeSubtitle = "subtitle"
+	CodecTypeData     = "data"
+)
+
+// Metadata is what ffprobe -show_format -show_streams reports about a file
+type Metadata struct {
+	Streams []Stream `json:"streams"`
+	Format  Format   `json:"format"`
+}
+
+type Stream struct {
+	Index         int    `json:"index"`
+	CodecName     string `json:"codec_name"`
+	CodecLongName string `json:"codec_long_name"`
+	CodecType     string `json:"codec_type"`
+	Profile       string `json:"profile"`
+
+	// Audio
+	SampleRate    Number `json:"sample_rate"`
+	Channels      int    `json:"channels"`
+	ChannelLayout string `json:"channel_layout"`
+
+	// Video
+	Width        int      `json:"width"`
+	Height       int      `json:"height"`
+	FrameRate    Rational `json:"r_frame_rate"`
+	AvgFrameRate Rational `json:"avg_frame_rate"`
+	PixFmt       string   `json:"pix_fmt"`
+
+	BitRate     Number            `json:"bit_rate"`
+	Duration    Seconds           `json:"duration"`
+	Disposition map[string]int    `json:"disposition"`
+	Tags        map[string]string `json:"tags"`
+}
+
+type Format struct {
+	Filename       string            `json:"filename"`
+	FormatName     string            `json:"format_name"`
+	FormatLongName string            `json:"format_long_name"`
+	NumStreams     int               `json:"nb_streams"`
+	Duration       Seconds           `json:"duration"`
+	Size           Number            `json:"size"`
+	BitRate        Number            `json:"bit_rate"`
+	Tags           map[string]string `json:"tags"`
+}
+
+// AudioStreams returns every audio stream, in file order
+func (m Metadata) AudioStreams() []Stream {
+	var streams []Stream
+	for _, s := range m.Streams {
+		if s.CodecType == CodecTypeAudio {
+			streams = append(streams, s)
+		}
+	}
+	return streams
+}
+
+// VideoStream returns the first video stream that isn't cover art
+func (m Metadata) VideoStream() (Stream, bool) {
+	for _, s := range m.Streams {
+		if s.CodecType == CodecTypeVideo && !s.IsCoverArt() {
+			return s, true
+		}
+	}
+	return Stream{}, false
+}
+
+// CoverArt returns the stream holding the embedded cover image, if any
+func (m Metadata) CoverArt() (Stream, bool) {
+	for _, s := range m.Streams {
+		if s.IsCoverArt() {
+			return s, true
+		}
+	}
+	return Stream{}, false
+}
+
+// Duration is the duration of the file, or of its longest stream if the
+// container doesn't say
+func (m Metadata) Duration() time.Duration {
+	if m.Format.Duration > 0 {
+		return m.Format.Duration.Duration()
+	}
+	var d Seconds
+	for _, s := range m.Streams {
+		if s.Duration > d {
+			d = s.Duration
+		}
+	}
+	return d.Duration()
+}
+
+// IsCoverArt reports whether the stream is an attached picture rather than
+// actual video
+func (s Stream) IsCoverArt() bool {
+	return s.Disposition["attached_pic"] == 1
+}
+
+// Number is an integer that ffprobe writes as a string
+type Number int64
+
+func (n *Number) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" || s == "N/A" {
+		*n = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %s", b)
+	}
+	*n = Number(v)
+	return nil
+}
+
+// Seconds is a duration that ffprobe writes as a string of seconds
+type Seconds float64
+
+func (d *Seconds) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" || s == "N/A" {
+		*d = 0
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid duration %s", b)
+	}
+	*d = Seconds(v)
+	return nil
+}
+
+func (d Seconds) Duration() time.Duration {
+	return time.Duration(float64(d) * float64(time.Second))
+}
+
+// Rational is a ratio like a frame rate, written "30000/1001"
+type Rational struct {
+	Num int
+	Den int
+}
+
+func (r *Rational) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		den = "1"
+	}
+	var err error
+	r.Num, err = strconv.Atoi(num)
+	if err != nil {
+		return fmt.Errorf("invalid ratio %q", s)
+	}
+	r.Den, err = strconv.Atoi(den)
+	if err != nil {
+		return fmt.Errorf("invalid ratio %q", s)
+	}
+	return nil
+}
+
+func (r Rational) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r Rational) String() string {
+	return fmt.Sprintf("%d/%d", r.Num, r.Den)
+}
+
+// Float returns the ratio as a number, or 0 if it is undefined
+func (r Rational) Float() float64 {
+	if r.Den == 0 {
+		return 0
+	}
+	return float64(r.Num) / float64(r.Den)
+}
@@ -0,0 +1,94 @@
+package encoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrBadOutput is returned for an existing output that is truncated or
+// missing its stream, when it isn't being verified
+var ErrBadOutput = errors.New("output is incomplete")
+
+// WithVerify encodes existing outputs again if they are incomplete, instead
+// of failing them
+func WithVerify(verify bool) EncoderOption {
+	return func(e *Encoder) {
+		e.verify = verify
+	}
+}
+
+// WithDurationTolerance sets how far an output's duration may be from its
+// source's before it counts as truncated
+func WithDurationTolerance(d time.Duration) EncoderOption {
+	return func(e *Encoder) {
+		e.tolerance = d
+	}
+}
+
+// OutputExists reports whether outFile has already been written
+func OutputExists(outFile string) bool {
+	st, err := os.Stat(outFile)
+	return err == nil && st.Size() > 0
+}
+
+// partialPath is where an output is written until it is complete. It keeps
+// the extension, since ffmpeg picks the format from it, and is hidden so
+// directory listings skip it.
+func partialPath(outFile string) string {
+	dir, base := filepath.Split(outFile)
+	ext := filepath.Ext(base)
+	return filepath.Join(dir, "."+base[:len(base)-len(ext)]+".partial"+ext)
+}
+
+// existing decides what to do with an output that is already there. It
+// returns ErrOutputExists to skip it, nil to encode it again, or an error if
+// it is incomplete and not being verified.
+func (e Encoder) existing(ctx context.Context, src Metadata, inFile, outFile, codecType string) error {
+	err := e.checkOutput(ctx, src, outFile, codecType)
+	switch {
+	case err == nil:
+		slog.Info("Skipping", "file", inFile)
+		return ErrOutputExists
+	case !e.verify:
+		return fmt.Errorf("%w, use -verify to encode it again: %w", ErrBadOutput, err)
+	}
+	slog.Warn("Encoding again", "file", inFile, "reason", err)
+	return nil
+}
+
+// checkOutput compares an output with its source: it must have a stream of
+// codecType, and be as long as the source
+func (e Encoder) checkOutput(ctx context.Context, src Metadata, outFile, codecType string) error {
+	out, err := e.GetMetadata(ctx, outFile)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, s := range out.Streams {
+		if s.CodecType == codecType && !s.IsCoverArt() {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s has no %s stream", outFile, codecType)
+	}
+	want, got := src.Duration(), out.Duration()
+	if want > 0 && (got < want-e.tolerance || got > want+e.tolerance) {
+		return fmt.Errorf("%s is %s long, want %s", outFile, got.Round(time.Millisecond), want.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// commit moves a finished partial output into place
+func commit(partial, outFile string) error {
+	err := os.Rename(partial, outFile)
+	if err != nil {
+		os.Remove(partial)
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package encoder
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress is how far ffmpeg has got with one file
+type Progress struct {
+	File string
+	// Out is how much of the output has been written, in media time
+	Out time.Duration
+	// Duration is the length of the input, 0 if ffprobe didn't know
+	Duration time.Duration
+	// Speed is how many times faster than real time ffmpeg is going
+	Speed float64
+	Done  bool
+}
+
+// Fraction is how much is done, from 0 to 1
+func (p Progress) Fraction() float64 {
+	if p.Done {
+		return 1
+	}
+	if p.Duration <= 0 {
+		return 0
+	}
+	return min(float64(p.Out)/float64(p.Duration), 1)
+}
+
+// ETA is how long until the file is done, or 0 if it can't tell yet
+func (p Progress) ETA() time.Duration {
+	if p.Done || p.Duration <= 0 || p.Speed <= 0 {
+		return 0
+	}
+	left := p.Duration - p.Out
+	if left < 0 {
+		return 0
+	}
+	return time.Duration(float64(left) / p.Speed)
+}
+
+// WithProgress calls fn as ffmpeg reports progress, a couple of times a
+// second per file. fn is called from several goroutines when files are
+// encoded at once.
+func WithProgress(fn func(Progress)) EncoderOption {
+	return func(e *Encoder) {
+		e.progress = fn
+	}
+}
+
+// ffmpeg runs ffmpeg, reporting its progress if there's a progress callback
+func (e Encoder) ffmpeg(ctx context.Context, file string, duration time.Duration, args ...string) error {
+	if e.progress == nil {
+		cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+		cmd.Stdout = e.stdout
+		cmd.Stderr = e.stderr
+		return cmd.Run()
+	}
+
+	args = append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stderr = e.stderr
+	pipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	readProgress(pipe, Progress{File: file, Duration: duration}, e.progress)
+	return cmd.Wait()
+}
+
+// readProgress parses the key=value blocks ffmpeg writes with -progress.
+// Each block ends with progress=continue, or progress=end for the last.
+func readProgress(r io.Reader, p Progress, fn func(Progress)) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(sc.Text()), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "out_time_us", "out_time_ms":
+			// Despite the name, out_time_ms is in microseconds too
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+				p.Out = time.Duration(us) * time.Microsecond
+			}
+		case "speed":
+			if x, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+				p.Speed = x
+			}
+		case "progress":
+			p.Done = value == "end"
+			fn(p)
+		}
+	}
+	// Keep ffmpeg from blocking on a full pipe if the scanner gave up
+	io.Copy(io.Discard, r)
+}
@@ -0,0 +1,79 @@
+package encoder
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// progressStream is what ffmpeg writes with -progress, trimmed to the keys
+// readProgress looks at plus a few it ignores
+const progressStream = `frame=0
+out_time_us=2500000
+out_time_ms=2500000
+out_time=00:00:02.500000
+speed=2.00x
+progress=continue
+out_time_us=N/A
+out_time_ms=5000000
+speed=N/A
+progress=continue
+not a key value line
+out_time_us=N/A
+out_time_ms=N/A
+progress=continue
+out_time_us=7500000` + "\r" + `
+speed=4x
+progress=continue
+out_time_us=12000000
+progress=continue
+out_time_us=9900000
+progress=end
+`
+
+func TestReadProgress(t *testing.T) {
+	want := []struct {
+		fraction float64
+		speed    float64
+		eta      time.Duration
+		done     bool
+	}{
+		{0.25, 2, 3750 * time.Millisecond, false},
+		// N/A keeps the last time, and out_time_ms is in microseconds
+		{0.5, 2, 2500 * time.Millisecond, false},
+		{0.5, 2, 2500 * time.Millisecond, false},
+		{0.75, 4, 625 * time.Millisecond, false},
+		// Past the duration ffprobe gave is still all done
+		{1, 4, 0, false},
+		{1, 4, 0, true},
+	}
+	var got []Progress
+	readProgress(strings.NewReader(progressStream), Progress{File: "a.mp4", Duration: 10 * time.Second}, func(p Progress) {
+		got = append(got, p)
+	})
+	if len(got) != len(want) {
+		t.Fatalf("got %d reports, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		p := got[i]
+		if p.File != "a.mp4" || p.Fraction() != w.fraction || p.Speed != w.speed || p.ETA() != w.eta || p.Done != w.done {
+			t.Errorf("report %d: got %+v, fraction %v, eta %v, want %+v", i, p, p.Fraction(), p.ETA(), w)
+		}
+	}
+}
+
+func TestProgressUnknownDuration(t *testing.T) {
+	var got []Progress
+	readProgress(strings.NewReader("out_time_us=2500000\nspeed=1x\nprogress=continue\nprogress=end\n"), Progress{}, func(p Progress) {
+		got = append(got, p)
+	})
+	if len(got) != 2 {
+		t.Fatalf("got %d reports, want 2", len(got))
+	}
+	if got[0].Fraction() != 0 || got[0].ETA() != 0 {
+		t.Errorf("got fraction %v eta %v without a duration", got[0].Fraction(), got[0].ETA())
+	}
+	if got[1].Fraction() != 1 {
+		t.Errorf("got fraction %v once done", got[1].Fraction())
+	}
+}
@@ -0,0 +1,151 @@
+package encoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/bmurray/resolumeconverter/pool"
+)
+
+// ErrOutputExists is returned when the output was already written, and the
+// file was skipped
+var ErrOutputExists = errors.New("output already exists")
+
+const (
+	JobConverted = "converted"
+	JobSkipped   = "skipped"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// Job is one file to convert. Run must stop when its context is done.
+type Job struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+type JobResult struct {
+	Name    string
+	Status  string
+	Err     error
+	Elapsed time.Duration
+}
+
+// Scheduler runs jobs a few at a time. A failed job doesn't stop the others.
+type Scheduler struct {
+	workers int
+	log     *slog.Logger
+	onDone  func(JobResult)
+}
+
+type SchedulerOption func(*Scheduler)
+
+// WithWorkers sets how many jobs run at once; the default is one per CPU
+func WithWorkers(n int) SchedulerOption {
+	return func(s *Scheduler) {
+		if n > 0 {
+			s.workers = n
+		}
+	}
+}
+
+func WithSchedulerLogger(l *slog.Logger) SchedulerOption {
+	return func(s *Scheduler) {
+		s.log = l
+	}
+}
+
+// WithJobDone calls fn as each job finishes, from the worker that ran it
+func WithJobDone(fn func(JobResult)) SchedulerOption {
+	return func(s *Scheduler) {
+		s.onDone = fn
+	}
+}
+
+func NewScheduler(opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		workers: runtime.NumCPU(),
+		log:     slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Run runs every job and returns their results in the same order. Once ctx
+// is done, running jobs are stopped and the rest are marked canceled. Every
+// failure is returned joined together.
+func (s *Scheduler) Run(ctx context.Context, jobs []Job) ([]JobResult, error) {
+	results := make([]JobResult, len(jobs))
+	for i, job := range jobs {
+		results[i] = JobResult{Name: job.Name, Status: JobCanceled}
+	}
+
+	pool.Each(ctx, s.workers, len(jobs), func(i int) {
+		results[i] = s.run(ctx, jobs[i])
+		if s.onDone != nil {
+			s.onDone(results[i])
+		}
+	})
+
+	var errs []error
+	for _, res := range results {
+		if res.Status == JobFailed {
+			errs = append(errs, fmt.Errorf("%s: %w", res.Name, res.Err))
+		}
+	}
+	if ctx.Err() != nil {
+		errs = append(errs, ctx.Err())
+	}
+	return results, errors.Join(errs...)
+}
+
+func (s *Scheduler) run(ctx context.Context, job Job) JobResult {
+	res := JobResult{Name: job.Name}
+	start := time.Now()
+	err := job.Run(ctx)
+	res.Elapsed = time.Since(start)
+	switch {
+	case err == nil:
+		res.Status = JobConverted
+	case errors.Is(err, ErrOutputExists):
+		res.Status = JobSkipped
+	case ctx.Err() != nil:
+		res.Status = JobCanceled
+		res.Err = ctx.Err()
+	default:
+		res.Status = JobFailed
+		res.Err = err
+		s.log.Error("Error converting", "file", job.Name, "error", err)
+	}
+	return res
+}
+
+type Summary struct {
+	Converted int `json:"converted"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+	Canceled  int `json:"canceled"`
+}
+
+func Summarize(results []JobResult) Summary {
+	var sum Summary
+	for _, res := range results {
+		switch res.Status {
+		case JobConverted:
+			sum.Converted++
+		case JobSkipped:
+			sum.Skipped++
+		case JobFailed:
+			sum.Failed++
+		case JobCanceled:
+			sum.Canceled++
+		}
+	}
+	return sum
+}
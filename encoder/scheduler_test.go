@@ -0,0 +1,141 @@
+package encoder
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func quiet() SchedulerOption {
+	return WithSchedulerLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestSchedulerRun(t *testing.T) {
+	errBad := errors.New("bad file")
+	var jobs []Job
+	want := []string{}
+	for i, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		var err error
+		status := JobConverted
+		switch name {
+		case "b":
+			err, status = ErrOutputExists, JobSkipped
+		case "e":
+			err, status = errBad, JobFailed
+		}
+		// Later jobs finish first, and results still come back in order
+		delay := time.Duration(6-i) * time.Millisecond
+		jobs = append(jobs, Job{Name: name, Run: func(ctx context.Context) error {
+			time.Sleep(delay)
+			return err
+		}})
+		want = append(want, name+" "+status)
+	}
+
+	var mu sync.Mutex
+	var finished []string
+	s := NewScheduler(WithWorkers(3), quiet(), WithJobDone(func(res JobResult) {
+		mu.Lock()
+		finished = append(finished, res.Name)
+		mu.Unlock()
+	}))
+	results, err := s.Run(context.Background(), jobs)
+	if !errors.Is(err, errBad) || !strings.Contains(err.Error(), "e: bad file") {
+		t.Errorf("got error %v", err)
+	}
+	var got []string
+	for _, res := range results {
+		got = append(got, res.Name+" "+res.Status)
+		if res.Elapsed <= 0 {
+			t.Errorf("%s took %v", res.Name, res.Elapsed)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got results %q, want %q", got, want)
+	}
+	if len(finished) != len(jobs) {
+		t.Errorf("told of %d finished jobs, want %d", len(finished), len(jobs))
+	}
+	if sum := Summarize(results); sum != (Summary{Converted: 4, Skipped: 1, Failed: 1}) {
+		t.Errorf("got summary %+v", sum)
+	}
+}
+
+func TestSchedulerWorkers(t *testing.T) {
+	for _, workers := range []int{1, 2, 4} {
+		var running, most atomic.Int32
+		var jobs []Job
+		for range 12 {
+			jobs = append(jobs, Job{Name: "job", Run: func(ctx context.Context) error {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					m := most.Load()
+					if n <= m || most.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				time.Sleep(2 * time.Millisecond)
+				return nil
+			}})
+		}
+		results, err := NewScheduler(WithWorkers(workers), quiet()).Run(context.Background(), jobs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum := Summarize(results); sum.Converted != 12 {
+			t.Errorf("%d workers: got %+v", workers, sum)
+		}
+		if int(most.Load()) > workers {
+			t.Errorf("%d workers: %d jobs ran at once", workers, most.Load())
+		}
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var started atomic.Int32
+	var jobs []Job
+	for range 10 {
+		jobs = append(jobs, Job{Name: "job", Run: func(ctx context.Context) error {
+			// Both workers are busy until the second job cancels
+			if started.Add(1) == 2 {
+				cancel()
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}})
+	}
+	results, err := NewScheduler(WithWorkers(2), quiet()).Run(ctx, jobs)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v", err)
+	}
+	if len(results) != len(jobs) {
+		t.Fatalf("got %d results, want %d", len(results), len(jobs))
+	}
+	// Stopped jobs and ones never started are both canceled
+	if sum := Summarize(results); sum.Canceled != len(jobs) {
+		t.Errorf("got %+v", sum)
+	}
+	if n := started.Load(); n > 3 {
+		t.Errorf("started %d jobs after cancelling", n)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left, started with %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
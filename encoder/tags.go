@@ -0,0 +1,63 @@
+package encoder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// carriedTags are the tags Engine shows, which Encode checks made it into
+// the audio file
+var carriedTags = []string{"artist", "album", "album_artist", "genre", "date", "composer", "track", "disc", "comment"}
+
+// Tag looks up a tag ignoring case, in the container's tags and then the
+// first audio stream's. Matroska keeps tags upper case, mp4 lower case.
+func (m Metadata) Tag(key string) string {
+	if v, ok := lookupTag(m.Format.Tags, key); ok {
+		return v
+	}
+	if streams := m.AudioStreams(); len(streams) > 0 {
+		v, _ := lookupTag(streams[0].Tags, key)
+		return v
+	}
+	return ""
+}
+
+func lookupTag(tags map[string]string, key string) (string, bool) {
+	if v, ok := tags[key]; ok {
+		return v, true
+	}
+	for k, v := range tags {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// verifyTags reads outFile back and checks it has the title and cover art
+// it should, and the tags src had. A wrong title or missing cover is an
+// error; Resolume can't match a wrong title. Other tags only warn.
+func (e Encoder) verifyTags(ctx context.Context, src Metadata, outFile, title string, wantCover bool) error {
+	out, err := e.GetMetadata(ctx, outFile)
+	if err != nil {
+		return err
+	}
+	if got := out.Tag("title"); got != title {
+		return fmt.Errorf("%s has title %q, want %q", outFile, got, title)
+	}
+	if _, ok := out.CoverArt(); wantCover && !ok {
+		return fmt.Errorf("%s has no cover art", outFile)
+	}
+	for _, key := range carriedTags {
+		want := strings.TrimSpace(src.Tag(key))
+		if want == "" {
+			continue
+		}
+		if got := strings.TrimSpace(out.Tag(key)); got != want {
+			slog.Warn("Tag was not carried over", "file", outFile, "tag", key, "want", want, "got", got)
+		}
+	}
+	return nil
+}
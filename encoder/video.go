@@ -0,0 +1,115 @@
+package encoder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HAP flavours, as ffmpeg's hap encoder names them
+const (
+	VideoHAP      = "hap"
+	VideoHAPQ     = "hap_q"
+	VideoHAPAlpha = "hap_alpha"
+)
+
+// VideoTarget is what EncodeVideo writes. HAP is decoded on the GPU, which
+// is what lets Arena play it as smoothly as DXV.
+type VideoTarget struct {
+	Format string
+	// Width and Height resize the video. If only one is set the other keeps
+	// the aspect ratio.
+	Width  int
+	Height int
+	// FPS changes the frame rate; 0 keeps the source's
+	FPS float64
+}
+
+var DefaultVideoTarget = VideoTarget{Format: VideoHAP}
+
+func (t VideoTarget) Validate() error {
+	switch t.Format {
+	case VideoHAP, VideoHAPQ, VideoHAPAlpha:
+	default:
+		return fmt.Errorf("unknown video format %q, use hap, hap_q or hap_alpha", t.Format)
+	}
+	if t.Width < 0 || t.Height < 0 || t.FPS < 0 {
+		return fmt.Errorf("size and frame rate can't be negative")
+	}
+	return nil
+}
+
+// Ext is the extension of the files written, without the dot
+func (t VideoTarget) Ext() string {
+	return "mov"
+}
+
+// filter is the ffmpeg filter chain for the target. HAP needs both sides to
+// be a multiple of 4, so sizes are rounded to one even when not resizing.
+func (t VideoTarget) filter() string {
+	var filters []string
+	switch {
+	case t.Width > 0 && t.Height > 0:
+		filters = append(filters, fmt.Sprintf("scale=%d:%d", t.Width/4*4, t.Height/4*4))
+	case t.Width > 0:
+		filters = append(filters, fmt.Sprintf("scale=%d:-4", t.Width/4*4))
+	case t.Height > 0:
+		filters = append(filters, fmt.Sprintf("scale=-4:%d", t.Height/4*4))
+	default:
+		filters = append(filters, "scale=trunc(iw/4)*4:trunc(ih/4)*4")
+	}
+	if t.FPS > 0 {
+		filters = append(filters, "fps="+strconv.FormatFloat(t.FPS, 'f', -1, 64))
+	}
+	if t.Format == VideoHAPAlpha {
+		filters = append(filters, "format=rgba")
+	}
+	return strings.Join(filters, ",")
+}
+
+func WithVideoTarget(t VideoTarget) EncoderOption {
+	return func(e *Encoder) {
+		e.video = t
+	}
+}
+
+// VideoExt is the extension EncodeVideo expects its output files to have
+func (e Encoder) VideoExt() string {
+	return e.video.Ext()
+}
+
+// EncodeVideo encodes inFile to HAP without audio, since Arena only needs the
+// picture; the sound comes from Engine. Files already encoded are skipped
+// with ErrOutputExists.
+func (e Encoder) EncodeVideo(ctx context.Context, inFile, outFile string) error {
+	data, err := e.GetMetadata(ctx, inFile)
+	if err != nil {
+		return err
+	}
+	if OutputExists(outFile) {
+		err := e.existing(ctx, data, inFile, outFile, CodecTypeVideo)
+		if err != nil {
+			return err
+		}
+	}
+	slog.Info("Encoding video", "file", inFile, "format", e.video.Format)
+	partial := partialPath(outFile)
+	args := []string{
+		"-i", inFile,
+		"-an",
+		"-map", "0:V:0",
+		"-filter:v", e.video.filter(),
+		"-c:v", "hap",
+		"-format", e.video.Format,
+		"-y", partial,
+	}
+	err = e.ffmpeg(ctx, inFile, data.Duration(), args...)
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return commit(partial, outFile)
+}
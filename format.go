@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// reportFormat is the -format flag of the commands that print a report. It
+// only takes the formats the command can write.
+type reportFormat struct {
+	value   string
+	formats []string
+}
+
+// formatFlag registers a format flag on fs. The first format is the default.
+func formatFlag(fs *flag.FlagSet, name string, formats ...string) *reportFormat {
+	f := &reportFormat{value: formats[0], formats: formats}
+	fs.Var(f, name, "Output `format`: "+f.choices())
+	return f
+}
+
+func (f *reportFormat) choices() string {
+	last := len(f.formats) - 1
+	if last == 0 {
+		return f.formats[0]
+	}
+	return strings.Join(f.formats[:last], ", ") + " or " + f.formats[last]
+}
+
+func (f *reportFormat) String() string {
+	return f.value
+}
+
+func (f *reportFormat) Set(v string) error {
+	if !slices.Contains(f.formats, v) {
+		return fmt.Errorf("unknown format %q, use %s", v, f.choices())
+	}
+	f.value = v
+	return nil
+}
@@ -1,5 +1,11 @@
 module github.com/bmurray/resolumeconverter
 
-go 1.21.0
+go 1.22
 
-require github.com/google/uuid v1.6.0 // indirect
+require (
+	github.com/gorilla/websocket v1.5.3
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/text v0.22.0
+)
+
+require golang.org/x/sys v0.30.0 // indirect
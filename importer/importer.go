@@ -0,0 +1,218 @@
+// Package importer adds video files to a Resolume composition in bulk.
+//
+// The composition is fetched once and every file is given its own empty clip
+// up front, so the clips can then be opened concurrently. Layers only have to
+// be fetched again when the importer has to add columns or layers.
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bmurray/resolumeconverter/pool"
+	"github.com/bmurray/resolumeconverter/resolume"
+)
+
+const (
+	// GrowColumns adds a column when the layers are full
+	GrowColumns = "columns"
+	// GrowLayer adds a layer, in the same group as the last layer
+	GrowLayer = "layer"
+	// GrowNone stops the import when the layers are full
+	GrowNone = "none"
+
+	// SpreadFill fills each layer before moving on to the next
+	SpreadFill = "fill"
+	// SpreadRoundRobin deals clips out across the layers
+	SpreadRoundRobin = "round-robin"
+)
+
+type Importer struct {
+	r   *resolume.Resolume
+	log *slog.Logger
+
+	workers       int
+	grow          string
+	spread        string
+	loadTimeout   time.Duration
+	pollInterval  time.Duration
+	transportType string
+	target        string
+
+	// dryRun makes Plan pretend to add columns and layers
+	dryRun bool
+	nextId int
+}
+
+type Option func(*Importer)
+
+// WithWorkers sets how many clips are opened at once
+func WithWorkers(n int) Option {
+	return func(im *Importer) {
+		if n > 0 {
+			im.workers = n
+		}
+	}
+}
+
+func WithGrow(policy string) Option {
+	return func(im *Importer) {
+		im.grow = policy
+	}
+}
+
+func WithSpread(policy string) Option {
+	return func(im *Importer) {
+		im.spread = policy
+	}
+}
+
+// WithLoadTimeout sets how long to wait for Arena to load a clip
+func WithLoadTimeout(d time.Duration) Option {
+	return func(im *Importer) {
+		im.loadTimeout = d
+	}
+}
+
+// WithDryRun keeps Plan from changing the composition. When it runs out of
+// room, the columns or layers it would add are planned with New set.
+func WithDryRun(dryRun bool) Option {
+	return func(im *Importer) {
+		im.dryRun = dryRun
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(im *Importer) {
+		im.log = l
+	}
+}
+
+func NewImporter(r *resolume.Resolume, opts ...Option) *Importer {
+	im := &Importer{
+		r:             r,
+		log:           slog.Default().With("pkg", "importer"),
+		workers:       4,
+		grow:          GrowColumns,
+		spread:        SpreadFill,
+		loadTimeout:   30 * time.Second,
+		pollInterval:  100 * time.Millisecond,
+		transportType: resolume.TransportDenon,
+		target:        resolume.TargetDenon,
+	}
+	for _, opt := range opts {
+		opt(im)
+	}
+	return im
+}
+
+// Placement is where a file goes. Layer and Column are 1 indexed.
+type Placement struct {
+	File    string `json:"file"`
+	ClipId  int    `json:"clip_id"`
+	LayerId int    `json:"layer_id"`
+	Layer   int    `json:"layer"`
+	Column  int    `json:"column"`
+	// Exists is set for files that are already in the composition
+	Exists bool `json:"exists,omitempty"`
+	// New is set, in a dry run, when the clip is in a column or layer that
+	// would have to be added. ClipId and LayerId are made up.
+	New bool `json:"new,omitempty"`
+}
+
+// Result is the outcome of importing one file
+type Result struct {
+	Placement
+	Err error
+}
+
+// Import adds files to the layers with the given ids, skipping any that are
+// already in the composition. A failure doesn't stop the other files; every
+// error is returned joined together. If ctx is done part way, only the files
+// that were got to have a result.
+func (im *Importer) Import(ctx context.Context, files []string, layerIds []int) ([]Result, error) {
+	if im.dryRun {
+		return nil, fmt.Errorf("can't import in a dry run, use Plan")
+	}
+	placements, _, err := im.Plan(ctx, files, layerIds)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(placements))
+	var todo []int
+	for i, p := range placements {
+		if p.Exists {
+			results[i] = Result{Placement: p}
+			continue
+		}
+		todo = append(todo, i)
+	}
+	pool.Each(ctx, im.workers, len(todo), func(j int) {
+		i := todo[j]
+		results[i] = Result{Placement: placements[i]}
+		results[i].Err = im.open(ctx, placements[i])
+	})
+
+	var done []Result
+	var errs []error
+	for _, res := range results {
+		// Never handed to a worker
+		if res.File == "" {
+			continue
+		}
+		done = append(done, res)
+		if res.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", res.File, res.Err))
+		}
+	}
+	if ctx.Err() != nil {
+		errs = append(errs, ctx.Err())
+	}
+	return done, errors.Join(errs...)
+}
+
+// open loads a file into its clip, waits for Arena to finish loading it and
+// then sets the transport and target
+func (im *Importer) open(ctx context.Context, p Placement) error {
+	im.log.Info("Opening clip", "file", p.File, "layer", p.Layer, "column", p.Column)
+	err := im.r.OpenClip(ctx, p.ClipId, p.File)
+	if err != nil {
+		return err
+	}
+	err = im.waitLoaded(ctx, p.ClipId)
+	if err != nil {
+		return err
+	}
+	// The target options depend on the transport, so set the transport first
+	err = im.r.SetChoice(ctx, p.ClipId, "transporttype", im.transportType)
+	if err != nil {
+		return err
+	}
+	return im.r.SetChoice(ctx, p.ClipId, "target", im.target)
+}
+
+// waitLoaded polls the clip until it is no longer empty
+func (im *Importer) waitLoaded(ctx context.Context, clipId int) error {
+	ctx, cancel := context.WithTimeout(ctx, im.loadTimeout)
+	defer cancel()
+	t := time.NewTicker(im.pollInterval)
+	defer t.Stop()
+	for {
+		clip, err := im.r.GetClip(ctx, clipId)
+		if err == nil && clip.Connected.Value != "Empty" {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("clip %d did not load: %w", clipId, err)
+			}
+			return fmt.Errorf("clip %d did not load: %w", clipId, ctx.Err())
+		case <-t.C:
+		}
+	}
+}
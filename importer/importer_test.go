@@ -0,0 +1,232 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bmurray/resolumeconverter/resolume"
+	"github.com/bmurray/resolumeconverter/resolume/resolumetest"
+)
+
+type slot struct {
+	layer, column int
+}
+
+// videos makes empty files to import
+func videos(t *testing.T, names ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	files := make([]string, len(names))
+	for i, name := range names {
+		files[i] = filepath.Join(dir, name+".mov")
+		if err := os.WriteFile(files[i], nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+// slots finds where each file ended up in the composition
+func slots(comp resolume.Composition) map[string]slot {
+	s := make(map[string]slot)
+	for l, layer := range comp.Layers {
+		for c, clip := range layer.Clips {
+			if path := clip.Video.FileInfo.Path; path != "" {
+				s[path] = slot{l + 1, c + 1}
+			}
+		}
+	}
+	return s
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name    string
+		layers  int
+		columns int
+		opts    []Option
+		want    []slot
+	}{
+		{"fill", 2, 2, nil, []slot{{1, 1}, {1, 2}, {2, 1}}},
+		{"round robin", 2, 2, []Option{WithSpread(SpreadRoundRobin)}, []slot{{1, 1}, {2, 1}, {1, 2}}},
+		{"grow columns", 2, 1, nil, []slot{{1, 1}, {2, 1}, {1, 2}}},
+		{"grow layer", 1, 2, []Option{WithGrow(GrowLayer)}, []slot{{1, 1}, {1, 2}, {2, 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comp := resolumetest.NewComposition(tt.layers, tt.columns)
+			srv := resolumetest.NewServer(comp)
+			defer srv.Close()
+			r := resolume.NewResolume(srv.BaseURL())
+			files := videos(t, "One", "Two", "Three")
+
+			var layerIds []int
+			for _, layer := range comp.Layers {
+				layerIds = append(layerIds, layer.Id)
+			}
+			results, err := NewImporter(r, tt.opts...).Import(context.Background(), files, layerIds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(files) {
+				t.Fatalf("got %d results, want %d", len(results), len(files))
+			}
+
+			got := srv.Composition()
+			at := slots(got)
+			for i, file := range files {
+				if at[file] != tt.want[i] {
+					t.Errorf("%s is in %v, want %v", filepath.Base(file), at[file], tt.want[i])
+				}
+				res := results[i]
+				if res.Layer != at[file].layer || res.Column != at[file].column {
+					t.Errorf("%s was reported in %d/%d, but is in %v", filepath.Base(file), res.Layer, res.Column, at[file])
+				}
+				clip := got.Layers[at[file].layer-1].Clips[at[file].column-1]
+				if clip.TransportType.Value != resolume.TransportDenon || clip.Target.Value != resolume.TargetDenon {
+					t.Errorf("%s has transport %q and target %q", filepath.Base(file), clip.TransportType.Value, clip.Target.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestImportSkipsExisting(t *testing.T) {
+	comp := resolumetest.NewComposition(1, 3)
+	files := videos(t, "One", "Two")
+	comp.Layers[0].Clips[1].Video.FileInfo.Path = files[0]
+	comp.Layers[0].Clips[1].Connected.Value = resolumetest.ConnectedOptions[1]
+	srv := resolumetest.NewServer(comp)
+	defer srv.Close()
+	r := resolume.NewResolume(srv.BaseURL())
+
+	results, err := NewImporter(r).Import(context.Background(), files, []int{comp.Layers[0].Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Exists || results[0].Column != 2 {
+		t.Errorf("got %+v, want the existing clip in column 2", results[0].Placement)
+	}
+	if at := slots(srv.Composition())[files[1]]; at != (slot{1, 1}) {
+		t.Errorf("Two is in %v, want the first free clip", at)
+	}
+}
+
+func TestImportFull(t *testing.T) {
+	comp := resolumetest.NewComposition(1, 1)
+	srv := resolumetest.NewServer(comp)
+	defer srv.Close()
+	r := resolume.NewResolume(srv.BaseURL())
+
+	_, err := NewImporter(r, WithGrow(GrowNone)).Import(context.Background(), videos(t, "One", "Two"), []int{comp.Layers[0].Id})
+	if err == nil {
+		t.Error("imported more files than there are clips")
+	}
+}
+
+func TestImportCancelled(t *testing.T) {
+	comp := resolumetest.NewComposition(1, 4)
+	h := resolumetest.NewHandler(comp)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Stop once the first clip is opened
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		if strings.HasSuffix(r.URL.Path, "/open") {
+			cancel()
+		}
+	}))
+	defer srv.Close()
+	base, _ := url.Parse(srv.URL + "/api/v1/")
+	r := resolume.NewResolume(base)
+
+	files := videos(t, "One", "Two", "Three", "Four")
+	results, err := NewImporter(r, WithWorkers(1)).Import(ctx, files, []int{comp.Layers[0].Id})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want it cancelled", err)
+	}
+	if len(results) == 0 || len(results) == len(files) {
+		t.Fatalf("got %d results, want some but not all", len(results))
+	}
+	for _, res := range results {
+		if res.File == "" || res.ClipId == 0 {
+			t.Errorf("got result for a file that wasn't imported: %+v", res)
+		}
+	}
+}
+
+func TestPlanDryRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		grow   string
+		want   []Growth
+		placed []slot
+	}{
+		{"columns", GrowColumns, []Growth{{Kind: GrowColumns, Column: 2, Before: 1}, {Kind: GrowColumns, Column: 3, Before: 2}}, []slot{{1, 1}, {1, 2}, {1, 3}}},
+		{"layer", GrowLayer, []Growth{{Kind: GrowLayer, Layer: 2, Before: 1}, {Kind: GrowLayer, Layer: 3, Before: 2}}, []slot{{1, 1}, {2, 1}, {3, 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comp := resolumetest.NewComposition(1, 1)
+			srv := resolumetest.NewServer(comp)
+			defer srv.Close()
+			r := resolume.NewResolume(srv.BaseURL())
+			im := NewImporter(r, WithGrow(tt.grow), WithDryRun(true))
+
+			placements, grown, err := im.Plan(context.Background(), videos(t, "One", "Two", "Three"), []int{comp.Layers[0].Id})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(grown) != len(tt.want) {
+				t.Fatalf("got growth %+v, want %+v", grown, tt.want)
+			}
+			for i := range grown {
+				if grown[i] != tt.want[i] {
+					t.Errorf("growth %d is %+v, want %+v", i, grown[i], tt.want[i])
+				}
+			}
+			for i, p := range placements {
+				if (slot{p.Layer, p.Column}) != tt.placed[i] {
+					t.Errorf("file %d placed in %d/%d, want %v", i, p.Layer, p.Column, tt.placed[i])
+				}
+				if p.New != (i > 0) {
+					t.Errorf("file %d has New %v", i, p.New)
+				}
+			}
+
+			got := srv.Composition()
+			if len(got.Layers) != 1 || len(got.Layers[0].Clips) != 1 {
+				t.Error("a dry run changed the composition")
+			}
+		})
+	}
+}
+
+func TestPretendRoomCopies(t *testing.T) {
+	comp := resolumetest.NewComposition(2, 1)
+	for l := range comp.Layers {
+		// Room to grow in place, as a shared backing array would
+		comp.Layers[l].Clips = append(make([]resolume.Clip, 0, 4), comp.Layers[l].Clips...)
+	}
+	snap := newSnapshot(comp, make(map[int]bool))
+	im := NewImporter(nil, WithDryRun(true))
+
+	grown, _, _, err := im.pretendRoom(snap, []int{comp.Layers[0].Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(grown.comp.Layers[0].Clips); n != 2 {
+		t.Fatalf("got %d columns, want 2", n)
+	}
+	grown.comp.Layers[0].Clips[0].Name.Value = "Changed"
+	if comp.Layers[0].Clips[0].Name.Value == "Changed" || snap.comp.Layers[0].Clips[0].Name.Value == "Changed" {
+		t.Error("the grown snapshot shares clips with the original")
+	}
+}
@@ -0,0 +1,275 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bmurray/resolumeconverter/resolume"
+)
+
+// snapshot indexes a composition for planning: which files are already in
+// it, and which clips are still free.
+type snapshot struct {
+	comp     resolume.Composition
+	existing map[string]Placement
+	reserved map[int]bool
+}
+
+func newSnapshot(comp resolume.Composition, reserved map[int]bool) *snapshot {
+	s := &snapshot{
+		comp:     comp,
+		existing: make(map[string]Placement),
+		reserved: reserved,
+	}
+	for l, layer := range comp.Layers {
+		for c, clip := range layer.Clips {
+			if path := clip.Video.FileInfo.Path; path != "" {
+				s.existing[path] = Placement{
+					File:    path,
+					ClipId:  clip.Id,
+					LayerId: layer.Id,
+					Layer:   l + 1,
+					Column:  c + 1,
+					Exists:  true,
+				}
+			}
+		}
+	}
+	return s
+}
+
+// take reserves the first free clip of a layer
+func (s *snapshot) take(layerId int) (Placement, bool) {
+	pos, layer, ok := s.comp.LayerById(layerId)
+	if !ok {
+		return Placement{}, false
+	}
+	for c, clip := range layer.Clips {
+		if clip.Connected.Value != "Empty" || s.reserved[clip.Id] {
+			continue
+		}
+		s.reserved[clip.Id] = true
+		return Placement{
+			ClipId:  clip.Id,
+			LayerId: layer.Id,
+			Layer:   pos,
+			Column:  c + 1,
+			New:     clip.Id < 0,
+		}, true
+	}
+	return Placement{}, false
+}
+
+// Growth is a column or layer added to make room, or in a dry run one that
+// would be
+type Growth struct {
+	// Kind is GrowColumns or GrowLayer
+	Kind string `json:"kind"`
+	// Column is the new column, Layer the new layer's position and Group the
+	// name of the group it went into, if any. All are 1 indexed.
+	Column int    `json:"column,omitempty"`
+	Layer  int    `json:"layer,omitempty"`
+	Group  string `json:"group,omitempty"`
+	// Before is how many placements were planned before it was added
+	Before int `json:"before"`
+}
+
+// Plan decides which clip each file goes into, without opening anything.
+// Files already in the composition are returned with Exists set. If the
+// layers are full, Plan makes room according to the grow policy, which does
+// change the composition unless this is a dry run, and returns what it grew.
+func (im *Importer) Plan(ctx context.Context, files []string, layerIds []int) ([]Placement, []Growth, error) {
+	if len(layerIds) == 0 {
+		return nil, nil, fmt.Errorf("no layers to import into")
+	}
+	comp, err := im.r.GetComposition(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, id := range layerIds {
+		if _, _, ok := comp.LayerById(id); !ok {
+			return nil, nil, fmt.Errorf("no layer with id %d", id)
+		}
+	}
+
+	layers := append([]int(nil), layerIds...)
+	snap := newSnapshot(comp, make(map[int]bool))
+	placements := make([]Placement, 0, len(files))
+	var grown []Growth
+	seen := make(map[string]bool)
+	next := 0
+	for _, file := range files {
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		if p, ok := snap.existing[file]; ok {
+			im.log.Info("Clip already exists", "clip", file)
+			placements = append(placements, p)
+			continue
+		}
+
+		for {
+			p, k, ok := im.reserve(snap, layers, next)
+			if ok {
+				next = k
+				if im.spread == SpreadRoundRobin {
+					next = (k + 1) % len(layers)
+				}
+				p.File = file
+				placements = append(placements, p)
+				break
+			}
+			snap, layers, next, err = im.makeRoom(ctx, snap, layers)
+			if err != nil {
+				return placements, grown, err
+			}
+			grown = append(grown, im.grew(snap, layers, len(placements)))
+		}
+	}
+	return placements, grown, nil
+}
+
+// grew describes what makeRoom just added, from the snapshot it returned
+func (im *Importer) grew(snap *snapshot, layers []int, before int) Growth {
+	g := Growth{Kind: im.grow, Before: before}
+	switch im.grow {
+	case GrowColumns:
+		for _, layer := range snap.comp.Layers {
+			g.Column = max(g.Column, len(layer.Clips))
+		}
+	case GrowLayer:
+		added := layers[len(layers)-1]
+		g.Layer, _, _ = snap.comp.LayerById(added)
+		if _, group, ok := snap.comp.GroupOf(added); ok {
+			g.Group = group.Name.Value
+		}
+	}
+	return g
+}
+
+// reserve takes a free clip from the first layer with room, starting at
+// layers[next]
+func (im *Importer) reserve(snap *snapshot, layers []int, next int) (Placement, int, bool) {
+	for n := 0; n < len(layers); n++ {
+		k := (next + n) % len(layers)
+		if p, ok := snap.take(layers[k]); ok {
+			return p, k, true
+		}
+	}
+	return Placement{}, 0, false
+}
+
+// makeRoom grows the composition and returns a fresh snapshot of it, keeping
+// the clips reserved so far.
+func (im *Importer) makeRoom(ctx context.Context, snap *snapshot, layers []int) (*snapshot, []int, int, error) {
+	if im.dryRun {
+		return im.pretendRoom(snap, layers)
+	}
+	next := 0
+	switch im.grow {
+	case GrowColumns:
+		im.log.Info("Layers are full, adding a column")
+		err := im.r.AddColumn(ctx)
+		if err != nil {
+			return snap, layers, 0, err
+		}
+	case GrowLayer:
+		// New layers go in the same group as the last layer
+		last := layers[len(layers)-1]
+		var added resolume.Layer
+		var err error
+		if group, g, ok := snap.comp.GroupOf(last); ok {
+			im.log.Info("Layers are full, adding a layer to the group", "group", g.Name.Value)
+			added, err = im.r.AddLayerToGroup(ctx, group)
+		} else {
+			im.log.Info("Layers are full, adding a layer")
+			added, err = im.r.AddLayer(ctx)
+		}
+		if err != nil {
+			return snap, layers, 0, err
+		}
+		layers = append(layers, added.Id)
+		next = len(layers) - 1
+	default:
+		return snap, layers, 0, resolume.ErrNoEmptyClip
+	}
+
+	comp, err := im.r.GetComposition(ctx)
+	if err != nil {
+		return snap, layers, 0, err
+	}
+	return newSnapshot(comp, snap.reserved), layers, next, nil
+}
+
+// pretendRoom adds columns or layers to the snapshot only, using negative
+// ids so they can't be mistaken for real ones.
+func (im *Importer) pretendRoom(snap *snapshot, layers []int) (*snapshot, []int, int, error) {
+	comp := copyLayers(snap.comp)
+	emptyClip := func() resolume.Clip {
+		im.nextId--
+		return resolume.Clip{
+			Id:        im.nextId,
+			Connected: resolume.ParamState{ValueType: resolume.ValueTypeState, Value: "Empty"},
+		}
+	}
+	next := 0
+	switch im.grow {
+	case GrowColumns:
+		im.log.Info("Layers are full, would add a column")
+		for l := range comp.Layers {
+			comp.Layers[l].Clips = append(comp.Layers[l].Clips, emptyClip())
+		}
+	case GrowLayer:
+		last := layers[len(layers)-1]
+		columns := 0
+		for _, layer := range comp.Layers {
+			if len(layer.Clips) > columns {
+				columns = len(layer.Clips)
+			}
+		}
+		im.nextId--
+		added := resolume.Layer{Id: im.nextId}
+		added.Name.Value = "New layer"
+		for c := 0; c < columns; c++ {
+			added.Clips = append(added.Clips, emptyClip())
+		}
+		// It goes on top of the group, or the top of the composition
+		pos := len(comp.Layers)
+		if group, _, ok := comp.GroupOf(last); ok {
+			g := &comp.Layergroups[group-1]
+			pos = 0
+			for _, gl := range g.Layers {
+				if i, _, ok := comp.LayerById(gl.Id); ok && i > pos {
+					pos = i
+				}
+			}
+			g.Layers = append(g.Layers, added)
+		}
+		comp.Layers = append(comp.Layers[:pos:pos], append([]resolume.Layer{added}, comp.Layers[pos:]...)...)
+		layers = append(layers, added.Id)
+		next = len(layers) - 1
+		im.log.Info("Layers are full, would add a layer", "layer", pos+1)
+	default:
+		return snap, layers, 0, resolume.ErrNoEmptyClip
+	}
+	return newSnapshot(comp, snap.reserved), layers, next, nil
+}
+
+// copyLayers copies the layers and groups of comp, so clips and layers can be
+// added to the copy without changing comp
+func copyLayers(comp resolume.Composition) resolume.Composition {
+	layers := make([]resolume.Layer, len(comp.Layers))
+	for i, layer := range comp.Layers {
+		layer.Clips = append([]resolume.Clip(nil), layer.Clips...)
+		layers[i] = layer
+	}
+	comp.Layers = layers
+	groups := make([]resolume.LayerGroup, len(comp.Layergroups))
+	for i, group := range comp.Layergroups {
+		group.Layers = append([]resolume.Layer(nil), group.Layers...)
+		groups[i] = group
+	}
+	comp.Layergroups = groups
+	return comp
+}
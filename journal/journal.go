@@ -0,0 +1,201 @@
+// Package journal records file renames so they can be undone later. Each
+// directory keeps its own journal, one JSON entry per line.
+package journal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const FileName = ".resolumeconverter-journal.jsonl"
+
+type Entry struct {
+	Original string    `json:"original"`
+	Renamed  string    `json:"renamed"`
+	Time     time.Time `json:"time"`
+	// Hash is the sha256 of the file, so undo can tell if it was replaced
+	Hash string `json:"sha256"`
+}
+
+type Journal struct {
+	path string
+	f    *os.File
+}
+
+// Open opens the journal in dir for appending, creating it if needed
+func Open(dir string) (*Journal, error) {
+	path := filepath.Join(dir, FileName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{path: path, f: f}, nil
+}
+
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
+
+// Rename renames a file and records it, returning the file's hash. If the
+// journal can't be written the rename is reverted, so there's never a rename
+// that can't be undone.
+func (j *Journal) Rename(from, to string) (string, error) {
+	// Undo may be run from another directory
+	from, err := filepath.Abs(from)
+	if err != nil {
+		return "", err
+	}
+	to, err = filepath.Abs(to)
+	if err != nil {
+		return "", err
+	}
+	hash, err := HashFile(from)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(from, to)
+	if err != nil {
+		return "", err
+	}
+	err = j.record(Entry{Original: from, Renamed: to, Time: time.Now(), Hash: hash})
+	if err != nil {
+		if rerr := os.Rename(to, from); rerr != nil {
+			return "", errors.Join(err, rerr)
+		}
+		return "", err
+	}
+	return hash, nil
+}
+
+func (j *Journal) record(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	_, err = j.f.Write(b)
+	if err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// Read returns the entries of the journal in dir, oldest first. A directory
+// without a journal has no entries.
+func Read(dir string) ([]Entry, error) {
+	f, err := os.Open(filepath.Join(dir, FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", FileName, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// Write replaces the journal in dir with entries. An empty journal is
+// removed.
+func Write(dir string, entries []Entry) error {
+	path := filepath.Join(dir, FileName)
+	if len(entries) == 0 {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	f, err := os.CreateTemp(dir, FileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Undo renames a file back to its original name. It refuses if the file has
+// changed since it was renamed, or if something else now has the original
+// name, ignoring case like the usual macOS, Windows and exFAT filesystems.
+func Undo(e Entry) error {
+	if other, ok := nameTaken(e.Original, e.Renamed); ok {
+		return fmt.Errorf("%s already exists", other)
+	}
+	hash, err := HashFile(e.Renamed)
+	if err != nil {
+		return err
+	}
+	if hash != e.Hash {
+		return fmt.Errorf("%s has changed since it was renamed", e.Renamed)
+	}
+	return os.Rename(e.Renamed, e.Original)
+}
+
+// nameTaken finds a file other than self with path's name, in any case
+func nameTaken(path, self string) (string, bool) {
+	dir := filepath.Dir(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	selfInfo, selfErr := os.Stat(self)
+	for _, e := range entries {
+		if !strings.EqualFold(e.Name(), filepath.Base(path)) {
+			continue
+		}
+		other := filepath.Join(dir, e.Name())
+		// Only the case changed, so the file itself has the name
+		if info, err := os.Stat(other); err == nil && selfErr == nil && os.SameFile(info, selfInfo) {
+			continue
+		}
+		return other, true
+	}
+	return "", false
+}
+
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,241 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// names lists the files in dir, leaving out the journal
+func names(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v []string
+	for _, e := range entries {
+		if e.Name() != FileName {
+			v = append(v, e.Name())
+		}
+	}
+	sort.Strings(v)
+	return v
+}
+
+// rename renames from to to in dir through a journal
+func rename(t *testing.T, dir, from, to string) string {
+	t.Helper()
+	j, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	hash, err := j.Rename(filepath.Join(dir, from), filepath.Join(dir, to))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestRenameAndUndo(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "Artist - Song (Official Video).mp4"), "one")
+	writeFile(t, filepath.Join(dir, "b.mp4"), "two")
+
+	hash := rename(t, dir, "Artist - Song (Official Video).mp4", "Song.mp4")
+	if want, _ := HashFile(filepath.Join(dir, "Song.mp4")); hash != want {
+		t.Errorf("got hash %s, want %s", hash, want)
+	}
+	rename(t, dir, "b.mp4", "Other.mp4")
+	if got := names(t, dir); !reflect.DeepEqual(got, []string{"Other.mp4", "Song.mp4"}) {
+		t.Fatalf("renamed to %q", got)
+	}
+
+	entries, err := Read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	e := entries[0]
+	if e.Original != filepath.Join(dir, "Artist - Song (Official Video).mp4") || e.Renamed != filepath.Join(dir, "Song.mp4") || e.Hash != hash || e.Time.IsZero() {
+		t.Errorf("got entry %+v", e)
+	}
+
+	// Newest first, as convert undo does
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := Undo(entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := names(t, dir); !reflect.DeepEqual(got, []string{"Artist - Song (Official Video).mp4", "b.mp4"}) {
+		t.Errorf("undone to %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "b.mp4")); got != "two" {
+		t.Errorf("b.mp4 has %q", got)
+	}
+}
+
+func TestFileFormat(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.mp4"), "one")
+	writeFile(t, filepath.Join(dir, "b.mp4"), "two")
+	rename(t, dir, "a.mp4", "A Song.mp4")
+	// Opening again appends
+	rename(t, dir, "b.mp4", "B Song.mp4")
+
+	f, err := os.Open(filepath.Join(dir, FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	lines := 0
+	for sc.Scan() {
+		lines++
+		var m map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatalf("line %d: %v", lines, err)
+		}
+		var keys []string
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, []string{"original", "renamed", "sha256", "time"}) {
+			t.Errorf("line %d has keys %q", lines, keys)
+		}
+	}
+	if lines != 2 {
+		t.Errorf("got %d lines, want 2", lines)
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	dir := t.TempDir()
+	if entries, err := Read(dir); err != nil || entries != nil {
+		t.Errorf("got %v, %v from a directory without a journal", entries, err)
+	}
+
+	entries := []Entry{
+		{Original: "/in/a.mp4", Renamed: "/in/A.mp4", Hash: "aa"},
+		{Original: "/in/b.mp4", Renamed: "/in/B.mp4", Hash: "bb"},
+	}
+	if err := Write(dir, entries); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("read back %+v", got)
+	}
+	// Nothing left behind but the journal
+	if left, _ := os.ReadDir(dir); len(left) != 1 {
+		t.Errorf("got %d files, want just the journal", len(left))
+	}
+
+	// An empty journal goes away
+	if err := Write(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, FileName)); !os.IsNotExist(err) {
+		t.Error("empty journal is still there")
+	}
+	if err := Write(dir, nil); err != nil {
+		t.Errorf("removing a missing journal: %v", err)
+	}
+}
+
+func TestReadBadLine(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, FileName), `{"original":"/a","renamed":"/b","sha256":"aa"}`+"\n\nnot json\n")
+	_, err := Read(dir)
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("got %v, want an error on line 3", err)
+	}
+}
+
+func TestUndoRefuses(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, dir string)
+	}{
+		{"original name taken", func(t *testing.T, dir string) {
+			writeFile(t, filepath.Join(dir, "a.mp4"), "someone else")
+		}},
+		{"original name taken in another case", func(t *testing.T, dir string) {
+			writeFile(t, filepath.Join(dir, "A.MP4"), "someone else")
+		}},
+		{"file changed", func(t *testing.T, dir string) {
+			writeFile(t, filepath.Join(dir, "Song.mp4"), "edited")
+		}},
+		{"file gone", func(t *testing.T, dir string) {
+			os.Remove(filepath.Join(dir, "Song.mp4"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "a.mp4"), "one")
+			rename(t, dir, "a.mp4", "Song.mp4")
+			entries, err := Read(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(t, dir)
+			before := names(t, dir)
+			if err := Undo(entries[0]); err == nil {
+				t.Error("undid the rename")
+			}
+			if got := names(t, dir); !reflect.DeepEqual(got, before) {
+				t.Errorf("files went from %q to %q", before, got)
+			}
+			for _, name := range before {
+				if name != "Song.mp4" && readFile(t, filepath.Join(dir, name)) != "someone else" {
+					t.Errorf("%s was overwritten", name)
+				}
+			}
+		})
+	}
+}
+
+func TestUndoCaseOnly(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "song.mp4"), "one")
+	rename(t, dir, "song.mp4", "Song.mp4")
+	entries, err := Read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Undo(entries[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, dir); !reflect.DeepEqual(got, []string{"song.mp4"}) {
+		t.Errorf("undone to %q", got)
+	}
+}
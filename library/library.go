@@ -0,0 +1,321 @@
+// Package library finds the videos, or audio files, in a directory tree.
+//
+// Files are recognised by the container their first bytes say they are, not
+// by their extension, so a stray .txt or .jpg is never sent to ffmpeg and an
+// .mp4 called .mov still is. Hidden files and directories are skipped, which
+// leaves out partial outputs and the rename journal.
+//
+// Which files are used can be narrowed with include and exclude globs, and
+// with a .resolumeignore file in any directory. Each line of one is a glob
+// matched like an exclude, relative to the directory it is in; blank lines
+// and lines starting with # are ignored.
+package library
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Containers Scan recognises
+const (
+	ContainerMP4      = "mp4"
+	ContainerMOV      = "mov"
+	ContainerMatroska = "matroska"
+	ContainerWebM     = "webm"
+	ContainerAVI      = "avi"
+
+	// Audio containers, found by scanners made WithAudio
+	ContainerM4A  = "m4a"
+	ContainerFLAC = "flac"
+	ContainerAIFF = "aiff"
+	ContainerMP3  = "mp3"
+)
+
+// IsAudio reports whether container only holds audio
+func IsAudio(container string) bool {
+	switch container {
+	case ContainerM4A, ContainerFLAC, ContainerAIFF, ContainerMP3:
+		return true
+	}
+	return false
+}
+
+// IgnoreFile lists globs to leave out of the directory it is in
+const IgnoreFile = ".resolumeignore"
+
+// File is a file found by Scan
+type File struct {
+	// Path is the file's path, starting with the directory scanned
+	Path string
+	// Rel is Path relative to the directory scanned, with slashes
+	Rel       string
+	Container string
+}
+
+// OutPath is where an output of f with extension ext goes in outDir, in the
+// same subdirectory f is in, so genre folders are kept
+func (f File) OutPath(outDir, ext string) string {
+	base := path.Base(f.Rel)
+	base = base[:len(base)-len(path.Ext(base))]
+	return filepath.Join(outDir, filepath.FromSlash(path.Dir(f.Rel)), base+"."+ext)
+}
+
+type Scanner struct {
+	include    []string
+	exclude    []string
+	audio      bool
+	containers []string
+}
+
+type ScannerOption func(*Scanner)
+
+// WithInclude only keeps files matching at least one of globs
+func WithInclude(globs ...string) ScannerOption {
+	return func(s *Scanner) {
+		s.include = append(s.include, globs...)
+	}
+}
+
+// WithExclude leaves out files, and whole directories, matching any of globs
+func WithExclude(globs ...string) ScannerOption {
+	return func(s *Scanner) {
+		s.exclude = append(s.exclude, globs...)
+	}
+}
+
+// WithAudio finds audio files, like the ones for Engine, instead of videos
+func WithAudio() ScannerOption {
+	return func(s *Scanner) {
+		s.audio = true
+	}
+}
+
+// WithContainers only keeps files in one of containers, like ContainerMOV
+// for the HAP and DXV files Arena plays
+func WithContainers(containers ...string) ScannerOption {
+	return func(s *Scanner) {
+		s.containers = append(s.containers, containers...)
+	}
+}
+
+func NewScanner(opts ...ScannerOption) (*Scanner, error) {
+	s := &Scanner{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	for _, g := range append(s.include, s.exclude...) {
+		if _, err := path.Match(strings.Trim(g, "/"), ""); err != nil {
+			return nil, fmt.Errorf("bad glob %q: %w", g, err)
+		}
+	}
+	return s, nil
+}
+
+// rule is an exclude glob, relative to dir
+type rule struct {
+	dir  string
+	glob string
+}
+
+// Scan walks root and returns every video, or audio file, in it, in lexical
+// order
+func (s *Scanner) Scan(ctx context.Context, root string) ([]File, error) {
+	rules := make([]rule, 0, len(s.exclude))
+	for _, g := range s.exclude {
+		rules = append(rules, rule{dir: ".", glob: g})
+	}
+	var files []File
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if excluded(rules, rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			ignored, err := readIgnore(filepath.Join(p, IgnoreFile), rel)
+			if err != nil {
+				return err
+			}
+			rules = append(rules, ignored...)
+			return nil
+		}
+		if !d.Type().IsRegular() || !s.included(rel) {
+			return nil
+		}
+		container, err := Sniff(p)
+		if err != nil {
+			return err
+		}
+		if container != "" && IsAudio(container) == s.audio && s.wanted(container) {
+			files = append(files, File{Path: p, Rel: rel, Container: container})
+		}
+		return nil
+	})
+	return files, err
+}
+
+func (s *Scanner) included(rel string) bool {
+	if len(s.include) == 0 {
+		return true
+	}
+	for _, g := range s.include {
+		if match(g, rel, false) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scanner) wanted(container string) bool {
+	if len(s.containers) == 0 {
+		return true
+	}
+	for _, c := range s.containers {
+		if c == container {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded reports whether a rule leaves out rel. Rules from an ignore file
+// only apply inside its directory.
+func excluded(rules []rule, rel string, isDir bool) bool {
+	for _, r := range rules {
+		sub := rel
+		if r.dir != "." {
+			if !strings.HasPrefix(rel, r.dir+"/") {
+				continue
+			}
+			sub = rel[len(r.dir)+1:]
+		}
+		if match(r.glob, sub, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// match matches a glob the way .gitignore does: one without a slash matches
+// the name of a file or directory at any depth, one with a slash matches the
+// whole path, and one ending in a slash only matches directories
+func match(glob, rel string, isDir bool) bool {
+	if strings.HasSuffix(glob, "/") {
+		if !isDir {
+			return false
+		}
+		glob = strings.TrimSuffix(glob, "/")
+	}
+	if strings.Contains(glob, "/") {
+		ok, _ := path.Match(strings.TrimPrefix(glob, "/"), rel)
+		return ok
+	}
+	ok, _ := path.Match(glob, path.Base(rel))
+	return ok
+}
+
+// readIgnore reads the ignore file at file, if there is one, in the directory
+// dir relative to the root
+func readIgnore(file, dir string) ([]rule, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules []rule
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := path.Match(strings.Trim(line, "/"), ""); err != nil {
+			return nil, fmt.Errorf("%s: bad glob %q: %w", file, line, err)
+		}
+		rules = append(rules, rule{dir: dir, glob: line})
+	}
+	return rules, sc.Err()
+}
+
+// Sniff returns the container the file at p is, from its first bytes, or ""
+// if it isn't one it knows. MP4s branded as audio, like the files the audio
+// command writes, are m4a rather than mp4.
+func Sniff(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return sniff(head[:n]), nil
+}
+
+func sniff(head []byte) string {
+	if len(head) < 12 {
+		return ""
+	}
+	switch string(head[4:8]) {
+	case "ftyp":
+		switch string(head[8:12]) {
+		case "qt  ":
+			return ContainerMOV
+		case "M4A ", "M4B ", "M4P ":
+			return ContainerM4A
+		}
+		return ContainerMP4
+	// QuickTime files from before ftyp start straight with an atom
+	case "moov", "mdat", "wide", "free", "skip", "pnot":
+		return ContainerMOV
+	}
+	if bytes.HasPrefix(head, []byte{0x1a, 0x45, 0xdf, 0xa3}) {
+		if bytes.Contains(head, []byte("webm")) {
+			return ContainerWebM
+		}
+		return ContainerMatroska
+	}
+	switch {
+	case string(head[:4]) == "RIFF" && string(head[8:12]) == "AVI ":
+		return ContainerAVI
+	case string(head[:4]) == "fLaC":
+		return ContainerFLAC
+	case string(head[:4]) == "FORM" && (string(head[8:12]) == "AIFF" || string(head[8:12]) == "AIFC"):
+		return ContainerAIFF
+	// An ID3 tag, or straight into an MPEG audio frame
+	case string(head[:3]) == "ID3", head[0] == 0xff && head[1]&0xe0 == 0xe0:
+		return ContainerMP3
+	}
+	return ""
+}
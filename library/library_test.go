@@ -0,0 +1,195 @@
+package library
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		glob  string
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		// No slash matches the name at any depth
+		{"*.mp4", "song.mp4", false, true},
+		{"*.mp4", "House/2024/song.mp4", false, true},
+		{"*.mp4", "song.mov", false, false},
+		{"Live", "Live", true, true},
+		{"Live", "House/Live", true, true},
+		{"Live", "House/Live.mp4", false, false},
+		// A slash matches the whole path, from the root
+		{"House/*", "House/song.mp4", false, true},
+		{"House/*", "House/2024/song.mp4", false, false},
+		{"House/*", "Techno/House/song.mp4", false, false},
+		{"/House/*", "House/song.mp4", false, true},
+		{"*/Live", "House/Live", true, true},
+		// A trailing slash only matches directories
+		{"Live/", "Live", true, true},
+		{"Live/", "Live", false, false},
+		{"Live/", "House/Live", true, true},
+		{"House/Live/", "House/Live", true, true},
+		{"House/Live/", "Live", true, false},
+	}
+	for _, tt := range tests {
+		if got := match(tt.glob, tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("match(%q, %q, dir %v) = %v, want %v", tt.glob, tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	rules := []rule{
+		{dir: ".", glob: "*.tmp"},
+		// From House/.resolumeignore
+		{dir: "House", glob: "Live"},
+		{dir: "House", glob: "2024/*.mp4"},
+	}
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"a.tmp", false, true},
+		{"House/a.tmp", false, true},
+		{"House/Live", true, true},
+		{"House/Sets/Live", true, true},
+		{"Live", true, false},
+		{"Techno/Live", true, false},
+		{"House/2024/song.mp4", false, true},
+		{"2024/song.mp4", false, false},
+		{"Housework/Live", true, false},
+		{"House/song.mp4", false, false},
+	}
+	for _, tt := range tests {
+		if got := excluded(rules, tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("excluded(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestSniff(t *testing.T) {
+	pad := func(b ...byte) []byte {
+		return append(b, make([]byte, 16)...)
+	}
+	atom := func(kind, brand string) []byte {
+		return pad(append([]byte{0, 0, 0, 0x20}, kind+brand...)...)
+	}
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"mp4", atom("ftyp", "isom"), ContainerMP4},
+		{"mov", atom("ftyp", "qt  "), ContainerMOV},
+		{"m4a", atom("ftyp", "M4A "), ContainerM4A},
+		{"audiobook", atom("ftyp", "M4B "), ContainerM4A},
+		{"quicktime without ftyp", atom("moov", "mvhd"), ContainerMOV},
+		{"quicktime starting with mdat", atom("mdat", "\x00\x00\x00\x00"), ContainerMOV},
+		{"quicktime starting with wide", atom("wide", "\x00\x00\x00\x00"), ContainerMOV},
+		{"matroska", pad(0x1a, 0x45, 0xdf, 0xa3, 0x42, 0x82, 0x88, 'm', 'a', 't', 'r', 'o', 's', 'k', 'a'), ContainerMatroska},
+		{"webm", pad(0x1a, 0x45, 0xdf, 0xa3, 0x42, 0x82, 0x84, 'w', 'e', 'b', 'm'), ContainerWebM},
+		{"avi", pad([]byte("RIFF\x00\x00\x00\x00AVI LIST")...), ContainerAVI},
+		{"wav", pad([]byte("RIFF\x00\x00\x00\x00WAVEfmt ")...), ""},
+		{"flac", pad([]byte("fLaC\x00\x00\x00\x22")...), ContainerFLAC},
+		{"aiff", pad([]byte("FORM\x00\x00\x00\x00AIFF")...), ContainerAIFF},
+		{"aifc", pad([]byte("FORM\x00\x00\x00\x00AIFC")...), ContainerAIFF},
+		{"mp3 with id3", pad([]byte("ID3\x04\x00")...), ContainerMP3},
+		{"mp3 frame sync", pad(0xff, 0xfb, 0x90, 0x64), ContainerMP3},
+		{"mpeg 2 frame sync", pad(0xff, 0xf3, 0x48, 0xc4), ContainerMP3},
+		{"not frame sync", pad(0xff, 0xd8, 0xff, 0xe0), ""},
+		{"jpeg", pad([]byte("\xff\xd8\xff\xdb")...), ""},
+		{"text", pad([]byte("hello, world")...), ""},
+		{"too short", []byte("ftyp"), ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := sniff(tt.head); got != tt.want {
+			t.Errorf("%s: sniff = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	root := t.TempDir()
+	mp4 := []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00")
+	mov := []byte("\x00\x00\x00\x20ftypqt  \x00\x00\x02\x00")
+	m4a := []byte("\x00\x00\x00\x20ftypM4A \x00\x00\x02\x00")
+	files := map[string][]byte{
+		"b.mp4":                     mp4,
+		"a.mov":                     mov,
+		"notes.txt":                 []byte("not a video at all"),
+		"song.m4a":                  m4a,
+		".hidden.mp4":               mp4,
+		".partial/c.mp4":            mp4,
+		"House/d.mp4":               mp4,
+		"House/Live/e.mp4":          mp4,
+		"House/2024/f.mov":          mov,
+		"House/" + IgnoreFile:       []byte("# live sets\nLive/\n\n"),
+		"Techno/Live/g.mp4":         mp4,
+		"Techno/misnamed.mov":       mp4,
+		"Techno/" + IgnoreFile:      []byte("*.tmp\n"),
+		"Techno/clip.tmp":           mp4,
+		"Techno/Deep/renamed.video": mov,
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts []ScannerOption
+		want []string
+	}{
+		{"videos", nil, []string{"House/2024/f.mov", "House/d.mp4", "Techno/Deep/renamed.video", "Techno/Live/g.mp4", "Techno/misnamed.mov", "a.mov", "b.mp4"}},
+		{"audio", []ScannerOption{WithAudio()}, []string{"song.m4a"}},
+		{"mov only", []ScannerOption{WithContainers(ContainerMOV)}, []string{"House/2024/f.mov", "Techno/Deep/renamed.video", "a.mov"}},
+		{"include", []ScannerOption{WithInclude("House/*")}, []string{"House/d.mp4"}},
+		{"exclude", []ScannerOption{WithExclude("Techno/", "*.mov")}, []string{"House/d.mp4", "b.mp4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewScanner(tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			found, err := s.Scan(context.Background(), root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range found {
+				got = append(got, f.Rel)
+				if f.Path != filepath.Join(root, filepath.FromSlash(f.Rel)) {
+					t.Errorf("%s has path %s", f.Rel, f.Path)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewScannerBadGlob(t *testing.T) {
+	if _, err := NewScanner(WithExclude("[")); err == nil {
+		t.Error("accepted a bad glob")
+	}
+}
+
+func TestOutPath(t *testing.T) {
+	f := File{Path: "in/House/Song.mp4", Rel: "House/Song.mp4"}
+	if got, want := f.OutPath("out", "mov"), filepath.Join("out", "House", "Song.mov"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,89 @@
+// Package match predicts whether Resolume will link a clip to a track.
+//
+// Engine sends the title tag of the playing track over StageLinq, and
+// Resolume looks for a clip with that name. It ignores case, extra spaces,
+// punctuation and featured artists, and treats the ways of typing the same
+// unicode character as one, but an accent still counts: "Café" and "Cafe"
+// don't sync. Key gives the form Resolume compares, and Explain says what
+// separates two titles that almost match.
+package match
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DiffAccents is the difference Explain finds between titles that only
+// differ by their accents
+const DiffAccents = "accents"
+
+// Key is the form of title that Resolume compares: the same unicode form
+// whichever way it was typed, without featured artists or punctuation, lower
+// case, with runs of spaces made one
+func Key(title string) string {
+	s := norm.NFC.String(title)
+	s = stripFeaturing(s)
+	s = stripPunctuation(s)
+	s = strings.ToLower(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Same reports whether Resolume will treat a and b as the same title
+func Same(a, b string) bool {
+	return Key(a) == Key(b)
+}
+
+var (
+	featBracketed = regexp.MustCompile(`(?i)\s*[(\[](feat\.?|ft\.?|featuring)\s[^)\]]*[)\]]`)
+	featTrailing  = regexp.MustCompile(`(?i)\s+(feat\.?|ft\.?|featuring)\s.*$`)
+)
+
+// Loose is Key with accents removed. Titles with the same Loose form but
+// different Keys are near misses.
+func Loose(title string) string {
+	return Key(stripAccents(title))
+}
+
+// Explain returns what keeps a and b from matching. It returns nil if they
+// match, and ok is false if they are different titles altogether.
+func Explain(a, b string) (diffs []string, ok bool) {
+	if Same(a, b) {
+		return nil, true
+	}
+	if Loose(a) != Loose(b) {
+		return nil, false
+	}
+	return []string{DiffAccents}, true
+}
+
+func stripFeaturing(s string) string {
+	s = featBracketed.ReplaceAllString(s, "")
+	return featTrailing.ReplaceAllString(s, "")
+}
+
+func stripAccents(s string) string {
+	s = norm.NFKD.String(s)
+	return strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// stripPunctuation drops apostrophes, so "Don't" is "Dont", and turns other
+// punctuation into spaces, so "AC/DC" is "AC DC"
+func stripPunctuation(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\'' || r == '’' || r == '‘':
+			return -1
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			return ' '
+		}
+		return r
+	}, s)
+}
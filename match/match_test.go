@@ -0,0 +1,115 @@
+package match
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The same title typed with a precomposed é, and with e and a combining
+// accent
+const (
+	cafeNFC = "Caf\u00e9 del Mar"
+	cafeNFD = "Cafe\u0301 del Mar"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Song", "song"},
+		{"  Some   Song\t", "some song"},
+		{cafeNFC, "café del mar"},
+		{cafeNFD, "café del mar"},
+		{"Beyoncé", "beyoncé"},
+		{"Don't Stop", "dont stop"},
+		{"Don’t Stop", "dont stop"},
+		{"AC/DC", "ac dc"},
+		{"Back In Black - Live!", "back in black live"},
+		{"Song (feat. Someone)", "song"},
+		{"Song [ft. Someone]", "song"},
+		{"Song (Featuring Someone Else)", "song"},
+		{"Song feat. Someone", "song"},
+		{"Song ft Someone", "song"},
+		{"Song (Extended Mix) (feat. Someone)", "song extended mix"},
+		// Words that only start like "feat" stay
+		{"Feather", "feather"},
+		{"Song (Featherweight Remix)", "song featherweight remix"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Key(tt.title); got != tt.want {
+			t.Errorf("Key(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestSame(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"Song", "SONG", true},
+		{"Some Song", "Some  Song ", true},
+		{cafeNFC, cafeNFD, true},
+		{cafeNFC, "Cafe del Mar", false},
+		{"Don't Stop", "Dont Stop", true},
+		{"Don’t Stop", "Don't Stop", true},
+		{"AC/DC", "AC DC", true},
+		{"AC/DC", "AC-DC", true},
+		{"AC/DC", "ACDC", false},
+		{"Song", "Song (feat. Someone)", true},
+		{"Song (feat. Someone)", "Song ft. Someone Else", true},
+		{"Song", "Song 2", false},
+	}
+	for _, tt := range tests {
+		if got := Same(tt.a, tt.b); got != tt.want {
+			t.Errorf("Same(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLoose(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{cafeNFC, "cafe del mar"},
+		{cafeNFD, "cafe del mar"},
+		{"Beyoncé", "beyonce"},
+		{"Café (feat. Someone)", "cafe"},
+		{"Don't Stop", "dont stop"},
+	}
+	for _, tt := range tests {
+		if got := Loose(tt.title); got != tt.want {
+			t.Errorf("Loose(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		diffs []string
+		ok    bool
+	}{
+		{"Song", "song", nil, true},
+		{cafeNFC, cafeNFD, nil, true},
+		{cafeNFC, "Cafe del Mar", []string{DiffAccents}, true},
+		{cafeNFD, "CAFE DEL MAR", []string{DiffAccents}, true},
+		// Punctuation and featured artists don't stop a match
+		{"Song (feat. Someone)", "Song", nil, true},
+		{"Don't Stop", "Dont Stop", nil, true},
+		{"Café (feat. Someone)", "Cafe", []string{DiffAccents}, true},
+		{"Beyoncé - Halo", "Beyonce Halo", []string{DiffAccents}, true},
+		{"AC/DC", "ACDC", nil, false},
+		{"Don't Stop Me Now", "Another One Bites the Dust", nil, false},
+		{"Song", "Song 2", nil, false},
+	}
+	for _, tt := range tests {
+		diffs, ok := Explain(tt.a, tt.b)
+		if ok != tt.ok || !reflect.DeepEqual(diffs, tt.diffs) {
+			t.Errorf("Explain(%q, %q) = %q, %v, want %q, %v", tt.a, tt.b, diffs, ok, tt.diffs, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// Package naming turns metadata titles into file names.
+//
+// Resolume matches the title Engine sends against clip names, and clip names
+// come from file names, so a file name has to be the title as closely as the
+// filesystem allows. Names are made safe for exFAT, since that is what the USB
+// sticks Engine reads from use, which also makes them safe everywhere else.
+package naming
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// CollisionCounter appends " (2)", " (3)", ... to the title
+	CollisionCounter = "counter"
+	// CollisionArtist appends the artist, then falls back to a counter
+	CollisionArtist = "artist"
+	// CollisionVersion appends the version, taken from the version tag or a
+	// bracketed part of the original file name, then falls back to a counter
+	CollisionVersion = "version"
+	// CollisionSkip leaves the file alone
+	CollisionSkip = "skip"
+)
+
+// maxLen leaves room for a suffix and extension under exFAT's 255 limit
+const maxLen = 200
+
+var replacer = strings.NewReplacer(
+	"/", "-",
+	"\\", "-",
+	"|", "-",
+	":", " - ",
+	"\"", "'",
+	"<", "(",
+	">", ")",
+	"?", "",
+	"*", "",
+)
+
+// reserved names can't be used on Windows or exFAT, with any extension
+var reserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Sanitize makes title safe to use as a file name, without the extension.
+// It returns "" if nothing usable is left.
+func Sanitize(title string) string {
+	s := strings.ToValidUTF8(title, "")
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+	s = replacer.Replace(s)
+	s = strings.Join(strings.Fields(s), " ")
+	s = trim(s)
+	if len(s) > maxLen {
+		cut := maxLen
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = trim(s[:cut])
+	}
+	if reserved[strings.ToUpper(s)] {
+		s += "_"
+	}
+	return s
+}
+
+// trim drops the trailing dots and spaces that Windows and exFAT strip or
+// reject, and leading dots and spaces too: a leading dot hides the file, and
+// the library scan skips hidden files
+func trim(s string) string {
+	return strings.Trim(s, ". ")
+}
+
+// Namer picks names for files in one directory. It remembers the names it
+// has handed out, so it can be used for a dry run where nothing is renamed.
+type Namer struct {
+	dir      string
+	strategy string
+	// taken maps lower cased names to the file that has them, since exFAT and
+	// the usual macOS and Windows filesystems ignore case
+	taken map[string]owner
+}
+
+// owner is the file a name was given to. In a dry run it is still at from,
+// otherwise it has been renamed to to.
+type owner struct {
+	from, to string
+}
+
+func (o owner) path() string {
+	if _, err := os.Stat(o.to); err == nil {
+		return o.to
+	}
+	return o.from
+}
+
+func NewNamer(dir, strategy string) (*Namer, error) {
+	switch strategy {
+	case CollisionCounter, CollisionArtist, CollisionVersion, CollisionSkip:
+	default:
+		return nil, fmt.Errorf("unknown collision strategy %q", strategy)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	n := &Namer{dir: dir, strategy: strategy, taken: make(map[string]owner)}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		n.taken[strings.ToLower(e.Name())] = owner{from: path, to: path}
+	}
+	return n, nil
+}
+
+// Name returns the path file should be renamed to, given its tags. ok is
+// false if the file should be left alone: its title is taken and the
+// strategy is skip, or the file with that title has the same content.
+// The new name counts as taken from then on.
+func (n *Namer) Name(file string, tags Tags) (newFile string, ok bool, err error) {
+	title := Sanitize(tags.Tag("title"))
+	if title == "" {
+		return "", false, fmt.Errorf("no usable title")
+	}
+	ext := filepath.Ext(file)
+
+	candidates := []string{title}
+	switch n.strategy {
+	case CollisionArtist:
+		if artist := Sanitize(tags.Tag("artist")); artist != "" {
+			candidates = append(candidates, fmt.Sprintf("%s (%s)", title, artist))
+		}
+	case CollisionVersion:
+		if version := Sanitize(Version(file, tags)); version != "" {
+			candidates = append(candidates, fmt.Sprintf("%s (%s)", title, version))
+		}
+	}
+
+	for i := 0; ; i++ {
+		var name string
+		switch {
+		case i < len(candidates):
+			name = candidates[i]
+		case n.strategy == CollisionSkip:
+			return "", false, nil
+		default:
+			name = fmt.Sprintf("%s (%d)", title, i-len(candidates)+2)
+		}
+		newFile = filepath.Join(n.dir, name+ext)
+		o, taken := n.taken[strings.ToLower(name+ext)]
+		if !taken || o.from == file || o.to == file {
+			n.take(file, newFile)
+			return newFile, true, nil
+		}
+		if same, _ := sameContent(file, o.path()); same {
+			return "", false, nil
+		}
+	}
+}
+
+func (n *Namer) take(file, newFile string) {
+	delete(n.taken, strings.ToLower(filepath.Base(file)))
+	n.taken[strings.ToLower(filepath.Base(newFile))] = owner{from: file, to: newFile}
+}
+
+// Tags looks up a file's tags by name, ignoring case, as encoder.Metadata
+// does
+type Tags interface {
+	Tag(key string) string
+}
+
+var bracketed = regexp.MustCompile(`[(\[]([^()\[\]]+)[)\]]`)
+
+// Version finds the version of a track: the version tag if there is one,
+// otherwise the last bracketed part of the file name that isn't already in
+// the title, like "Dirty Intro" in "Artist - Song (Dirty Intro).mp4"
+func Version(file string, tags Tags) string {
+	if v := tags.Tag("version"); v != "" {
+		return v
+	}
+	title := strings.ToLower(tags.Tag("title"))
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	matches := bracketed.FindAllStringSubmatch(base, -1)
+	for i := len(matches) - 1; i >= 0; i-- {
+		v := strings.TrimSpace(matches[i][1])
+		if v != "" && !strings.Contains(title, strings.ToLower(v)) {
+			return v
+		}
+	}
+	return ""
+}
+
+// sameContent reports whether two files are byte for byte the same
+func sameContent(a, b string) (bool, error) {
+	sa, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	sb, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	if os.SameFile(sa, sb) {
+		return true, nil
+	}
+	if sa.Size() != sb.Size() {
+		return false, nil
+	}
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	ba := make([]byte, 64*1024)
+	bb := make([]byte, 64*1024)
+	for {
+		na, erra := io.ReadFull(fa, ba)
+		nb, errb := io.ReadFull(fb, bb)
+		if !bytes.Equal(ba[:na], bb[:nb]) {
+			return false, nil
+		}
+		if erra == io.EOF || erra == io.ErrUnexpectedEOF {
+			return errb == io.EOF || errb == io.ErrUnexpectedEOF, nil
+		}
+		if erra != nil {
+			return false, erra
+		}
+		if errb != nil {
+			return false, errb
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package naming
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tags is a file's tags, looked up as encoder.Metadata does
+type tags map[string]string
+
+func (t tags) Tag(key string) string {
+	return t[strings.ToLower(key)]
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		title, want string
+	}{
+		{"Song", "Song"},
+		{"...Ready For It?", "Ready For It"},
+		{". Hidden", "Hidden"},
+		{"Mr. Brightside", "Mr. Brightside"},
+		{"Song...", "Song"},
+		{"  Song  Title  ", "Song Title"},
+		{"AC/DC", "AC-DC"},
+		{`Back\Slash|Pipe`, "Back-Slash-Pipe"},
+		{"Intro: Outro", "Intro - Outro"},
+		{`Say "Hi" <Live>`, "Say 'Hi' (Live)"},
+		{"Star*", "Star"},
+		{"Tab\tNew\nLine", "TabNewLine"},
+		{"Bad\xffUTF-8", "BadUTF-8"},
+		{"Café del Mar", "Café del Mar"},
+		{"con", "con_"},
+		{"LPT1", "LPT1_"},
+		{"Console", "Console"},
+		{"", ""},
+		{"???", ""},
+		{"...", ""},
+		{strings.Repeat("a", 250), strings.Repeat("a", maxLen)},
+		// Cutting never splits a rune or leaves a trailing dot
+		{strings.Repeat("a", maxLen-1) + "é", strings.Repeat("a", maxLen-1)},
+		{strings.Repeat("a", maxLen-1) + ".b", strings.Repeat("a", maxLen-1)},
+	}
+	for _, tt := range tests {
+		if got := Sanitize(tt.title); got != tt.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+// dir makes a directory holding the given files and contents
+func dir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	d := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(d, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d
+}
+
+func TestNamer(t *testing.T) {
+	type rename struct {
+		file string
+		tags tags
+		want string // "" if the file is left alone
+	}
+	tests := []struct {
+		name     string
+		strategy string
+		files    map[string]string
+		renames  []rename
+	}{
+		{"free", CollisionCounter, map[string]string{"a.mp4": "a"}, []rename{
+			{"a.mp4", tags{"title": "Song"}, "Song.mp4"},
+		}},
+		{"counter", CollisionCounter, map[string]string{"Song.mp4": "x", "a.mp4": "a", "b.mp4": "b"}, []rename{
+			{"a.mp4", tags{"title": "Song"}, "Song (2).mp4"},
+			// Names handed out count as taken
+			{"b.mp4", tags{"title": "Song"}, "Song (3).mp4"},
+		}},
+		{"artist", CollisionArtist, map[string]string{"Song.mp4": "x", "a.mp4": "a", "b.mp4": "b", "c.mp4": "c"}, []rename{
+			{"a.mp4", tags{"title": "Song", "artist": "Someone"}, "Song (Someone).mp4"},
+			{"b.mp4", tags{"title": "Song", "artist": "Someone"}, "Song (2).mp4"},
+			{"c.mp4", tags{"title": "Song"}, "Song (3).mp4"},
+		}},
+		{"version tag", CollisionVersion, map[string]string{"Song.mp4": "x", "a.mp4": "a"}, []rename{
+			{"a.mp4", tags{"title": "Song", "version": "Clean"}, "Song (Clean).mp4"},
+		}},
+		{"version from name", CollisionVersion, map[string]string{"Song.mp4": "x", "Artist - Song (Dirty Intro).mp4": "a", "Artist - Song (Song Remix).mp4": "b"}, []rename{
+			{"Artist - Song (Dirty Intro).mp4", tags{"title": "Song"}, "Song (Dirty Intro).mp4"},
+			// A bracket already in the title isn't a version
+			{"Artist - Song (Song Remix).mp4", tags{"title": "Song Remix"}, "Song Remix.mp4"},
+		}},
+		{"skip", CollisionSkip, map[string]string{"Song.mp4": "x", "a.mp4": "a", "b.mp4": "b"}, []rename{
+			{"a.mp4", tags{"title": "Song"}, ""},
+			{"b.mp4", tags{"title": "Other"}, "Other.mp4"},
+		}},
+		{"already named", CollisionSkip, map[string]string{"Song.mp4": "x"}, []rename{
+			{"Song.mp4", tags{"title": "Song"}, "Song.mp4"},
+		}},
+		{"case only", CollisionSkip, map[string]string{"song.mp4": "x"}, []rename{
+			{"song.mp4", tags{"title": "Song"}, "Song.mp4"},
+		}},
+		{"taken in another case", CollisionCounter, map[string]string{"SONG.mp4": "x", "a.mp4": "a"}, []rename{
+			{"a.mp4", tags{"title": "Song"}, "Song (2).mp4"},
+		}},
+		{"same content", CollisionCounter, map[string]string{"Song.mp4": "x", "a.mp4": "x"}, []rename{
+			{"a.mp4", tags{"title": "Song"}, ""},
+		}},
+		{"extension kept", CollisionCounter, map[string]string{"Song.mp4": "x", "a.mov": "a"}, []rename{
+			{"a.mov", tags{"title": "Song"}, "Song.mov"},
+		}},
+		{"hidden title", CollisionCounter, map[string]string{"a.mp4": "a"}, []rename{
+			{"a.mp4", tags{"title": "...Ready For It?"}, "Ready For It.mp4"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := dir(t, tt.files)
+			n, err := NewNamer(d, tt.strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range tt.renames {
+				got, ok, err := n.Name(filepath.Join(d, r.file), r.tags)
+				if err != nil {
+					t.Fatalf("%s: %v", r.file, err)
+				}
+				if r.want == "" {
+					if ok {
+						t.Errorf("%s renamed to %s, want it left alone", r.file, got)
+					}
+					continue
+				}
+				if !ok || got != filepath.Join(d, r.want) {
+					t.Errorf("%s renamed to %q, %v, want %s", r.file, got, ok, r.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNamerErrors(t *testing.T) {
+	d := dir(t, map[string]string{"a.mp4": "a"})
+	if _, err := NewNamer(d, "nope"); err == nil {
+		t.Error("made a namer with an unknown strategy")
+	}
+	if _, err := NewNamer(filepath.Join(d, "missing"), CollisionCounter); err == nil {
+		t.Error("made a namer for a missing directory")
+	}
+	n, err := NewNamer(d, CollisionCounter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"", "???", "..."} {
+		if got, _, err := n.Name(filepath.Join(d, "a.mp4"), tags{"title": title}); err == nil {
+			t.Errorf("title %q named %s", title, got)
+		}
+	}
+}
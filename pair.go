@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"text/tabwriter"
+
+	"github.com/bmurray/resolumeconverter/encoder"
+	"github.com/bmurray/resolumeconverter/library"
+	"github.com/bmurray/resolumeconverter/pairing"
+	"github.com/bmurray/resolumeconverter/plan"
+	"github.com/bmurray/resolumeconverter/state"
+)
+
+// pairReport is what pair prints as JSON
+type pairReport struct {
+	Audio *pairing.Report `json:"audio,omitempty"`
+	Video *pairing.Report `json:"video,omitempty"`
+}
+
+// pair links source videos to their audio and video outputs, however they
+// have been renamed, and reports the files on either side without a partner
+func pair(ctx context.Context, db *state.DB, args []string) {
+	fs := flag.NewFlagSet("pair", flag.ExitOnError)
+	format := formatFlag(fs, "format", plan.FormatTable, plan.FormatJSON)
+	prints := fs.Bool("fingerprint", true, "Compare audio fingerprints of the sources and audio files, which decodes two minutes of each")
+	workers := fs.Int("j", runtime.NumCPU(), "Number of files to read at once")
+	var scan scanFlags
+	scan.register(fs)
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) < 2 {
+		slog.Error("Need a source dir and an audio dir, and optionally a video dir")
+		return
+	}
+
+	enc := encoder.NewEncoder()
+	sched := encoder.NewScheduler(encoder.WithWorkers(*workers))
+	sources, err := pairItems(ctx, sched, enc, scan, args[0], false, *prints)
+	if err != nil {
+		slog.Error("Error reading sources", "error", err)
+		return
+	}
+	audios, err := pairItems(ctx, sched, enc, scan, args[1], true, *prints)
+	if err != nil {
+		slog.Error("Error reading audio", "error", err)
+		return
+	}
+	var videos []pairing.Item
+	if len(args) > 2 {
+		// The videos have no audio to fingerprint
+		videos, err = pairItems(ctx, sched, enc, scan, args[2], false, false)
+		if err != nil {
+			slog.Error("Error reading videos", "error", err)
+			return
+		}
+	}
+
+	knownAudio := make(map[string]string)
+	knownVideo := make(map[string]string)
+	tracks, _ := db.All()
+	for _, t := range tracks {
+		knownAudio[t.Path] = t.Audio
+		knownVideo[t.Path] = t.Video
+	}
+	var report pairReport
+	audioReport := pairing.NewPairer(pairing.WithKnown(knownAudio)).Pair(sources, audios)
+	report.Audio = &audioReport
+	if len(args) > 2 {
+		videoReport := pairing.NewPairer(pairing.WithKnown(knownVideo)).Pair(sources, videos)
+		report.Video = &videoReport
+	}
+
+	if format.value == plan.FormatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(report)
+		if err != nil {
+			slog.Error("Error writing report", "error", err)
+		}
+		return
+	}
+	writePairTable(sources, report)
+}
+
+// pairItems reads the files in dir, fingerprinting them if asked
+func pairItems(ctx context.Context, sched *encoder.Scheduler, enc *encoder.Encoder, scan scanFlags, dir string, audio, prints bool) ([]pairing.Item, error) {
+	opts := []library.ScannerOption{library.WithInclude(scan.include...), library.WithExclude(scan.exclude...)}
+	if audio {
+		opts = append(opts, library.WithAudio())
+	}
+	s, err := library.NewScanner(opts...)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.Scan(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]pairing.Item, len(files))
+	jobs := make([]encoder.Job, len(files))
+	for i, f := range files {
+		jobs[i] = encoder.Job{
+			Name: f.Path,
+			Run: func(ctx context.Context) error {
+				file, err := filepath.Abs(f.Path)
+				if err != nil {
+					return err
+				}
+				data, err := enc.GetMetadata(ctx, file)
+				if err != nil {
+					return err
+				}
+				items[i] = pairing.NewItem(file, data)
+				if prints && len(data.AudioStreams()) > 0 {
+					items[i].Print, err = enc.Fingerprint(ctx, file)
+					if err != nil {
+						slog.Warn("Not fingerprinting", "file", file, "error", err)
+					}
+				}
+				return nil
+			},
+		}
+	}
+	results, err := sched.Run(ctx, jobs)
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	// A file that can't be read can't be paired, but the rest still can
+	var read []pairing.Item
+	for i, res := range results {
+		if res.Status == encoder.JobConverted {
+			read = append(read, items[i])
+		}
+	}
+	return read, nil
+}
+
+// writePairTable prints a row for each source with its outputs, then a row
+// for each output with no source
+func writePairTable(sources []pairing.Item, report pairReport) {
+	audioOf := make(map[string]string)
+	videoOf := make(map[string]string)
+	for _, p := range report.Audio.Pairs {
+		audioOf[p.A.Path] = p.B.Path
+	}
+	if report.Video != nil {
+		for _, p := range report.Video.Pairs {
+			videoOf[p.A.Path] = p.B.Path
+		}
+	}
+	dash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if report.Video != nil {
+		fmt.Fprintln(tw, "SOURCE\tAUDIO\tVIDEO")
+	} else {
+		fmt.Fprintln(tw, "SOURCE\tAUDIO")
+	}
+	for _, s := range sources {
+		if report.Video != nil {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Path, dash(audioOf[s.Path]), dash(videoOf[s.Path]))
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\n", s.Path, dash(audioOf[s.Path]))
+		}
+	}
+	for _, a := range report.Audio.OnlyB {
+		if report.Video != nil {
+			fmt.Fprintf(tw, "-\t%s\t-\n", a.Path)
+		} else {
+			fmt.Fprintf(tw, "-\t%s\n", a.Path)
+		}
+	}
+	if report.Video != nil {
+		for _, v := range report.Video.OnlyB {
+			fmt.Fprintf(tw, "-\t-\t%s\n", v.Path)
+		}
+	}
+	tw.Flush()
+
+	attrs := []any{"no audio", len(report.Audio.OnlyA), "audio without source", len(report.Audio.OnlyB)}
+	if report.Video != nil {
+		attrs = append(attrs, "no video", len(report.Video.OnlyA), "video without source", len(report.Video.OnlyB))
+	}
+	slog.Info("Orphans", attrs...)
+}
@@ -0,0 +1,268 @@
+// Package pairing links the files of one track across pipeline stages: the
+// source video, the audio taken from it, and the video made from it. Names
+// aren't enough once files have been renamed, so pairs are scored on their
+// titles and artists, their durations and, where both have audio, an audio
+// fingerprint.
+package pairing
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bmurray/resolumeconverter/encoder"
+	"github.com/bmurray/resolumeconverter/match"
+)
+
+// Item is one file at one stage
+type Item struct {
+	Path     string        `json:"path"`
+	Title    string        `json:"title,omitempty"`
+	Artist   string        `json:"artist,omitempty"`
+	Duration time.Duration `json:"duration"`
+	// Print is nil for files without audio, or when fingerprints are off
+	Print encoder.Fingerprint `json:"-"`
+
+	// titleWords and artistWords are the Loose words of Title and Artist,
+	// kept so they aren't worked out again for every comparison
+	titleWords  map[string]bool
+	artistWords map[string]bool
+}
+
+// NewItem makes an Item from a file's metadata. Files without a title tag
+// go by their file name.
+func NewItem(path string, m encoder.Metadata) Item {
+	title := m.Tag("title")
+	if title == "" {
+		title = baseName(path)
+	}
+	return Item{Path: path, Title: title, Artist: m.Tag("artist"), Duration: m.Duration()}.prepared()
+}
+
+// prepared returns item with its word sets filled in
+func (item Item) prepared() Item {
+	if item.titleWords == nil {
+		item.titleWords = words(item.Title)
+	}
+	if item.artistWords == nil {
+		item.artistWords = words(item.Artist)
+	}
+	return item
+}
+
+type Pair struct {
+	A     Item    `json:"a"`
+	B     Item    `json:"b"`
+	Score float64 `json:"score"`
+	// Why lists the signals that agreed
+	Why []string `json:"why"`
+}
+
+// Report is the outcome of pairing two stages
+type Report struct {
+	Pairs []Pair `json:"pairs"`
+	// OnlyA and OnlyB are the files left without a partner
+	OnlyA []Item `json:"only_a"`
+	OnlyB []Item `json:"only_b"`
+}
+
+// Signals, as they appear in Pair.Why
+const (
+	WhyKnown       = "known"
+	WhyTitle       = "title"
+	WhyArtist      = "artist"
+	WhyDuration    = "duration"
+	WhyFingerprint = "fingerprint"
+)
+
+// Threshold is the score a pair needs
+const Threshold = 0.6
+
+// Pairer pairs the files of two stages
+type Pairer struct {
+	known map[string]string
+}
+
+type PairerOption func(*Pairer)
+
+// WithKnown pairs files already known to belong together, like the outputs
+// the state database recorded, before scoring the rest. It maps paths in
+// the first stage to paths in the second.
+func WithKnown(known map[string]string) PairerOption {
+	return func(p *Pairer) {
+		p.known = known
+	}
+}
+
+func NewPairer(opts ...PairerOption) *Pairer {
+	p := &Pairer{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Pair finds the best partner in b for each file in a. Each file is in at
+// most one pair; the best scoring pairs are taken first.
+func (p *Pairer) Pair(a, b []Item) Report {
+	a, b = prepareAll(a), prepareAll(b)
+	usedA := make([]bool, len(a))
+	usedB := make([]bool, len(b))
+	var report Report
+
+	byPath := make(map[string]int, len(b))
+	for j, item := range b {
+		byPath[item.Path] = j
+	}
+	for i, item := range a {
+		j, ok := byPath[p.known[item.Path]]
+		if !ok || usedB[j] {
+			continue
+		}
+		usedA[i], usedB[j] = true, true
+		report.Pairs = append(report.Pairs, Pair{A: item, B: b[j], Score: 1, Why: []string{WhyKnown}})
+	}
+
+	type candidate struct {
+		pair Pair
+		i, j int
+	}
+	var candidates []candidate
+	for i := range a {
+		if usedA[i] {
+			continue
+		}
+		for j := range b {
+			if usedB[j] {
+				continue
+			}
+			score, why := Score(a[i], b[j])
+			if score >= Threshold {
+				candidates = append(candidates, candidate{Pair{A: a[i], B: b[j], Score: score, Why: why}, i, j})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(x, y int) bool {
+		return candidates[x].pair.Score > candidates[y].pair.Score
+	})
+	for _, c := range candidates {
+		if usedA[c.i] || usedB[c.j] {
+			continue
+		}
+		usedA[c.i], usedB[c.j] = true, true
+		report.Pairs = append(report.Pairs, c.pair)
+	}
+
+	for i, item := range a {
+		if !usedA[i] {
+			report.OnlyA = append(report.OnlyA, item)
+		}
+	}
+	for j, item := range b {
+		if !usedB[j] {
+			report.OnlyB = append(report.OnlyB, item)
+		}
+	}
+	sort.Slice(report.Pairs, func(x, y int) bool {
+		return report.Pairs[x].A.Path < report.Pairs[y].A.Path
+	})
+	return report
+}
+
+// Score rates how likely a and b are the same track, from 0 to 1, as the
+// weighted average of the signals both files have. A fingerprint match is
+// enough on its own, but fingerprints are only compared for files whose
+// titles or durations are close enough to be worth it.
+func Score(a, b Item) (float64, []string) {
+	a, b = a.prepared(), b.prepared()
+	type signal struct {
+		why    string
+		weight float64
+		score  float64
+	}
+	signals := []signal{{WhyTitle, 0.5, wordSimilarity(a.titleWords, b.titleWords)}}
+	if a.Artist != "" && b.Artist != "" {
+		signals = append(signals, signal{WhyArtist, 0.15, wordSimilarity(a.artistWords, b.artistWords)})
+	}
+	plausible := signals[0].score > 0
+	if a.Duration > 0 && b.Duration > 0 {
+		d := durationSimilarity(a.Duration, b.Duration)
+		signals = append(signals, signal{WhyDuration, 0.35, d})
+		plausible = plausible || d > 0
+	} else {
+		plausible = true
+	}
+	if a.Print != nil && b.Print != nil && plausible {
+		// Unrelated audio is half the same by chance
+		s := (encoder.Similarity(a.Print, b.Print) - 0.5) * 2
+		s = min(1, max(0, s))
+		if s >= 0.6 {
+			return s, []string{WhyFingerprint}
+		}
+		signals = append(signals, signal{WhyFingerprint, 1, s})
+	}
+	var total, weights float64
+	var why []string
+	for _, s := range signals {
+		total += s.weight * s.score
+		weights += s.weight
+		if s.score >= 0.8 {
+			why = append(why, s.why)
+		}
+	}
+	return total / weights, why
+}
+
+func prepareAll(items []Item) []Item {
+	prepared := make([]Item, len(items))
+	for i, item := range items {
+		prepared[i] = item.prepared()
+	}
+	return prepared
+}
+
+// words is the set of words in the Loose form of s, ignoring what Resolume
+// would ignore and more
+func words(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(match.Loose(s)) {
+		set[w] = true
+	}
+	return set
+}
+
+// wordSimilarity is the share of words two titles have in common
+func wordSimilarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for w := range a {
+		if b[w] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+// durationSimilarity is 1 for durations within a second of each other,
+// falling to 0 at ten seconds apart
+func durationSimilarity(a, b time.Duration) float64 {
+	d := a - b
+	if d < 0 {
+		d = -d
+	}
+	switch {
+	case d <= time.Second:
+		return 1
+	case d >= 10*time.Second:
+		return 0
+	}
+	return 1 - float64(d-time.Second)/float64(9*time.Second)
+}
+
+func baseName(path string) string {
+	base := filepath.Base(path)
+	return base[:len(base)-len(filepath.Ext(base))]
+}
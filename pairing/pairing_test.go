@@ -0,0 +1,173 @@
+package pairing
+
+import (
+	"math/rand/v2"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bmurray/resolumeconverter/encoder"
+)
+
+// randomPrint is a fingerprint unrelated to any other
+func randomPrint(seed uint64) encoder.Fingerprint {
+	rng := rand.New(rand.NewPCG(seed, 0))
+	print := make(encoder.Fingerprint, 200)
+	for i := range print {
+		print[i] = rng.Uint32()
+	}
+	return print
+}
+
+func TestDurationSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b time.Duration
+		want float64
+	}{
+		{3 * time.Minute, 3 * time.Minute, 1},
+		{3 * time.Minute, 3*time.Minute + time.Second, 1},
+		{3*time.Minute + time.Second, 3 * time.Minute, 1},
+		{0, 5500 * time.Millisecond, 0.5},
+		{3 * time.Minute, 3*time.Minute - 5500*time.Millisecond, 0.5},
+		{3 * time.Minute, 3*time.Minute + 10*time.Second, 0},
+		{3 * time.Minute, 4 * time.Minute, 0},
+	}
+	for _, tt := range tests {
+		if got := durationSimilarity(tt.a, tt.b); got < tt.want-1e-9 || got > tt.want+1e-9 {
+			t.Errorf("durationSimilarity(%v, %v) = %f, want %f", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestWordSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"Some Song", "some song", 1},
+		{"Café (feat. Someone)", "Cafe", 1},
+		{"Some Song", "Some Other Song", 2.0 / 3},
+		{"Some Song", "Different", 0},
+		{"", "Song", 0},
+		{"Song Song", "Song", 1},
+	}
+	for _, tt := range tests {
+		if got := wordSimilarity(words(tt.a), words(tt.b)); got < tt.want-1e-9 || got > tt.want+1e-9 {
+			t.Errorf("wordSimilarity(%q, %q) = %f, want %f", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	song := Item{Title: "Some Song", Artist: "Someone", Duration: 3 * time.Minute, Print: randomPrint(1)}
+	tests := []struct {
+		name string
+		b    Item
+		pair bool
+		why  []string
+	}{
+		{"everything agrees", Item{Title: "Some Song", Artist: "Someone", Duration: 3 * time.Minute}, true, []string{WhyTitle, WhyArtist, WhyDuration}},
+		{"title and length", Item{Title: "some song (feat. Someone Else)", Duration: 3*time.Minute + time.Second}, true, []string{WhyTitle, WhyDuration}},
+		{"title only", Item{Title: "Some Song"}, true, []string{WhyTitle}},
+		{"title but not length", Item{Title: "Some Song", Duration: 5 * time.Minute}, false, []string{WhyTitle}},
+		{"length only", Item{Title: "Another Tune", Duration: 3 * time.Minute}, false, []string{WhyDuration}},
+		{"another artist's song", Item{Title: "Other Song", Artist: "Somebody", Duration: 4 * time.Minute}, false, nil},
+		{"renamed, but the audio matches", Item{Title: "Track 01", Duration: 3 * time.Minute, Print: randomPrint(1)}, true, []string{WhyFingerprint}},
+		{"same title, other audio", Item{Title: "Some Song", Artist: "Someone", Duration: 3 * time.Minute, Print: randomPrint(2)}, false, []string{WhyTitle, WhyArtist, WhyDuration}},
+		// Too far apart to be worth comparing the audio
+		{"same audio, nothing else", Item{Title: "Track 01", Duration: 10 * time.Minute, Print: randomPrint(1)}, false, nil},
+	}
+	for _, tt := range tests {
+		score, why := Score(song, tt.b)
+		if (score >= Threshold) != tt.pair {
+			t.Errorf("%s: score %.2f, want a pair %v", tt.name, score, tt.pair)
+		}
+		if !reflect.DeepEqual(why, tt.why) {
+			t.Errorf("%s: why %q, want %q", tt.name, why, tt.why)
+		}
+		if score < 0 || score > 1 {
+			t.Errorf("%s: score %.2f out of range", tt.name, score)
+		}
+	}
+}
+
+func paths(items []Item) []string {
+	var p []string
+	for _, item := range items {
+		p = append(p, item.Path)
+	}
+	return p
+}
+
+func TestPair(t *testing.T) {
+	minutes := func(m float64) time.Duration { return time.Duration(m * float64(time.Minute)) }
+	sources := []Item{
+		{Path: "src/a.mp4", Title: "Song (Official Video)", Duration: minutes(3)},
+		{Path: "src/b.mp4", Title: "Song", Duration: minutes(4)},
+		{Path: "src/c.mp4", Title: "Something Else Entirely", Duration: minutes(2)},
+		{Path: "src/d.mp4", Title: "Known", Duration: minutes(5)},
+	}
+	outputs := []Item{
+		// Both songs are called Song; the lengths say which is which
+		{Path: "out/Song.m4a", Title: "Song", Duration: minutes(3)},
+		{Path: "out/Song (1).m4a", Title: "Song", Duration: minutes(4)},
+		{Path: "out/Renamed.m4a", Title: "Nothing Like It", Duration: minutes(5)},
+		{Path: "out/Orphan.m4a", Title: "Orphan", Duration: minutes(6)},
+	}
+	p := NewPairer(WithKnown(map[string]string{"src/d.mp4": "out/Renamed.m4a"}))
+	report := p.Pair(sources, outputs)
+
+	got := make(map[string]string)
+	for _, pair := range report.Pairs {
+		got[pair.A.Path] = pair.B.Path
+	}
+	want := map[string]string{
+		"src/a.mp4": "out/Song.m4a",
+		"src/b.mp4": "out/Song (1).m4a",
+		"src/d.mp4": "out/Renamed.m4a",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got pairs %v, want %v", got, want)
+	}
+	if only := paths(report.OnlyA); !reflect.DeepEqual(only, []string{"src/c.mp4"}) {
+		t.Errorf("got sources without a partner %q", only)
+	}
+	if only := paths(report.OnlyB); !reflect.DeepEqual(only, []string{"out/Orphan.m4a"}) {
+		t.Errorf("got outputs without a partner %q", only)
+	}
+	for _, pair := range report.Pairs {
+		if pair.A.Path == "src/d.mp4" && !reflect.DeepEqual(pair.Why, []string{WhyKnown}) {
+			t.Errorf("known pair has why %q", pair.Why)
+		}
+	}
+	// Sorted by source
+	for i := 1; i < len(report.Pairs); i++ {
+		if report.Pairs[i-1].A.Path > report.Pairs[i].A.Path {
+			t.Errorf("pairs out of order: %q", paths([]Item{report.Pairs[i-1].A, report.Pairs[i].A}))
+		}
+	}
+}
+
+func TestPairGreedy(t *testing.T) {
+	// x fits both outputs, y only fits the first. The best pair, x with the
+	// first, is taken, even though it leaves y without a partner.
+	sources := []Item{
+		{Path: "x", Title: "Night Drive", Artist: "Band", Duration: 3 * time.Minute},
+		{Path: "y", Title: "Night Drive Remix", Duration: 3 * time.Minute},
+	}
+	outputs := []Item{
+		{Path: "1", Title: "Night Drive", Artist: "Band", Duration: 3 * time.Minute},
+		{Path: "2", Title: "Night Drive", Duration: 3*time.Minute + 4*time.Second},
+	}
+	report := NewPairer().Pair(sources, outputs)
+	got := make(map[string]string)
+	for _, pair := range report.Pairs {
+		got[pair.A.Path] = pair.B.Path
+	}
+	if got["x"] != "1" {
+		t.Errorf("x paired with %q, want 1", got["x"])
+	}
+	if b, ok := got["y"]; ok && b != "2" {
+		t.Errorf("y paired with %q, which was taken", b)
+	}
+}
@@ -0,0 +1,93 @@
+// Package plan collects what a command would do, so it can be reviewed before
+// anything on disk or in Arena is changed.
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+)
+
+const (
+	KindRename    = "rename"
+	KindEncode    = "encode"
+	KindPlace     = "place"
+	KindAddColumn = "add-column"
+	KindAddLayer  = "add-layer"
+	KindAddGroup  = "add-group"
+	KindMoveLayer = "move-layer"
+	KindWriteFile = "write"
+	KindSkip      = "skip"
+)
+
+// Formats of the plan and of the commands that print a report
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+type Action struct {
+	Kind   string `json:"kind"`
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Plan is safe to add to from several goroutines
+type Plan struct {
+	mu      sync.Mutex
+	actions []Action
+}
+
+func New() *Plan {
+	return &Plan{}
+}
+
+func (p *Plan) Add(a Action) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.actions = append(p.actions, a)
+}
+
+func (p *Plan) Actions() []Action {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Action(nil), p.actions...)
+}
+
+// Renamed returns where path would be after the planned renames
+func (p *Plan) Renamed(path string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, a := range p.actions {
+		if a.Kind == KindRename && a.Source == path {
+			path = a.Target
+		}
+	}
+	return path
+}
+
+// Write prints the plan as a table or as JSON
+func (p *Plan) Write(w io.Writer, format string) error {
+	actions := p.Actions()
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if actions == nil {
+			actions = []Action{}
+		}
+		return enc.Encode(actions)
+	case FormatTable, "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ACTION\tSOURCE\tTARGET\tDETAIL")
+		for _, a := range actions {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", a.Kind, a.Source, a.Target, a.Detail)
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unknown plan format %q", format)
+}
@@ -0,0 +1,39 @@
+// Package pool runs work a few items at a time.
+package pool
+
+import (
+	"context"
+	"sync"
+)
+
+// Each calls fn with every index from 0 to n-1, from at most workers
+// goroutines at once. Once ctx is done no more indexes are handed out, so fn
+// is only called for some of them. It returns once every call has returned,
+// and leaves no goroutines behind.
+func Each(ctx context.Context, workers, n int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	next := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(next)
+	wg.Wait()
+}
@@ -0,0 +1,84 @@
+package pool
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEach(t *testing.T) {
+	for _, workers := range []int{0, 1, 3, 20} {
+		var mu sync.Mutex
+		seen := make(map[int]int)
+		var running, most atomic.Int32
+		Each(context.Background(), workers, 10, func(i int) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := most.Load()
+				if n <= m || most.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			seen[i]++
+			mu.Unlock()
+		})
+		for i := 0; i < 10; i++ {
+			if seen[i] != 1 {
+				t.Errorf("%d workers: index %d ran %d times", workers, i, seen[i])
+			}
+		}
+		if len(seen) != 10 {
+			t.Errorf("%d workers: ran %d indexes, want 10", workers, len(seen))
+		}
+		if limit := max(workers, 1); int(most.Load()) > limit {
+			t.Errorf("%d workers: %d ran at once", workers, most.Load())
+		}
+	}
+}
+
+func TestEachNothing(t *testing.T) {
+	Each(context.Background(), 4, 0, func(i int) {
+		t.Errorf("called with %d", i)
+	})
+}
+
+func TestEachCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls atomic.Int32
+	Each(ctx, 2, 100, func(i int) {
+		// Both workers are busy until the second call cancels
+		if calls.Add(1) == 2 {
+			cancel()
+		}
+		<-ctx.Done()
+	})
+	// A worker freed as it was cancelled may have taken one more
+	if n := calls.Load(); n < 2 || n > 3 {
+		t.Errorf("got %d calls after cancelling on the second", n)
+	}
+	// The workers have returned, though the runtime may take a moment to
+	// count them gone
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left, started with %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	calls.Store(0)
+	Each(ctx, 2, 100, func(i int) {
+		calls.Add(1)
+	})
+	if n := calls.Load(); n != 0 {
+		t.Errorf("got %d calls with a done context", n)
+	}
+}
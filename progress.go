@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmurray/resolumeconverter/encoder"
+)
+
+const barWidth = 30
+
+// progressBars draws a bar for each file being encoded and one for the whole
+// batch, redrawn in place at the bottom of the terminal. Log lines written
+// through it go above the bars.
+type progressBars struct {
+	mu     sync.Mutex
+	w      io.Writer
+	total  int
+	done   int
+	start  time.Time
+	active map[string]encoder.Progress
+	order  []string
+	// drawn is how many lines the last draw took, to clear them
+	drawn int
+	last  time.Time
+}
+
+func newProgressBars(w io.Writer) *progressBars {
+	return &progressBars{w: w, active: make(map[string]encoder.Progress)}
+}
+
+// isTerminal reports whether f looks like a terminal rather than a file or
+// pipe, where redrawing bars would make a mess
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// Start shows the bars for a batch of total files, and sends the log through
+// them until Finish
+func (b *progressBars) Start(total int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total = total
+	b.done = 0
+	b.start = time.Now()
+	log.SetOutput(b)
+	b.draw()
+}
+
+func (b *progressBars) Finish() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clear()
+	log.SetOutput(os.Stderr)
+}
+
+// Update is the encoder's progress callback
+func (b *progressBars) Update(p encoder.Progress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.active[p.File]; !ok {
+		b.order = append(b.order, p.File)
+	}
+	b.active[p.File] = p
+	if time.Since(b.last) < 100*time.Millisecond {
+		return
+	}
+	b.clear()
+	b.draw()
+}
+
+// JobDone is the scheduler's callback
+func (b *progressBars) JobDone(res encoder.JobResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.active, res.Name)
+	for i, name := range b.order {
+		if name == res.Name {
+			b.order = append(b.order[:i], b.order[i+1:]...)
+			break
+		}
+	}
+	b.done++
+	b.clear()
+	b.draw()
+}
+
+// Write writes a log line above the bars
+func (b *progressBars) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clear()
+	n, err := b.w.Write(p)
+	b.draw()
+	return n, err
+}
+
+func (b *progressBars) clear() {
+	for ; b.drawn > 0; b.drawn-- {
+		fmt.Fprint(b.w, "\x1b[1A\x1b[2K")
+	}
+}
+
+func (b *progressBars) draw() {
+	b.last = time.Now()
+	overall := float64(b.done)
+	for _, name := range b.order {
+		p := b.active[name]
+		overall += p.Fraction()
+		eta := ""
+		if d := p.ETA(); d > 0 {
+			eta = "ETA " + formatETA(d)
+		}
+		fmt.Fprintf(b.w, "%-30s %s %3.0f%% %5.1fx %s\n", shorten(name, 30), bar(p.Fraction()), p.Fraction()*100, p.Speed, eta)
+		b.drawn++
+	}
+	if b.total > 0 {
+		overall /= float64(b.total)
+	}
+	eta := ""
+	if elapsed := time.Since(b.start); overall > 0 && overall < 1 {
+		eta = "ETA " + formatETA(time.Duration(float64(elapsed)*(1-overall)/overall))
+	}
+	fmt.Fprintf(b.w, "%-30s %s %d/%d %s\n", "Total", bar(overall), b.done, b.total, eta)
+	b.drawn++
+}
+
+func bar(fraction float64) string {
+	full := int(fraction * barWidth)
+	full = max(0, min(full, barWidth))
+	return "[" + strings.Repeat("=", full) + strings.Repeat(" ", barWidth-full) + "]"
+}
+
+// shorten keeps the end of a path, which has the file name
+func shorten(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return "…" + string(r[len(r)-n+1:])
+}
+
+func formatETA(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := int(d / time.Hour)
+	m := int(d/time.Minute) % 60
+	s := int(d/time.Second) % 60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
@@ -0,0 +1,180 @@
+package resolume
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LayerRef addresses a layer the way a user types it on the command line.
+// Exactly one of Index, Id or Name is set. Layers are 1 indexed; the bottom
+// layer is 1.
+type LayerRef struct {
+	Index int
+	Id    int
+	Name  string
+	// Group restricts Index and Name to the layers of the named layer group
+	Group string
+	// All selects every layer of Group
+	All bool
+}
+
+// ParseLayerRef parses a layer reference:
+//
+//	3                   the third layer from the bottom
+//	id:1234             the layer with id 1234
+//	Deck 1              the layer named "Deck 1"
+//	Music Videos/Deck 1 the layer named "Deck 1" in the group "Music Videos"
+//	Music Videos/2      the second layer of the group "Music Videos"
+//	Music Videos/*      every layer of the group "Music Videos"
+//
+// The first "/" separates the group, so a layer or group whose name has a
+// "/" in it, or a layer named like a number, can't be found by name. Use its
+// number or id instead.
+func ParseLayerRef(s string) (LayerRef, error) {
+	var ref LayerRef
+	if s == "" {
+		return ref, fmt.Errorf("empty layer")
+	}
+	if id, ok := strings.CutPrefix(s, "id:"); ok {
+		v, err := strconv.Atoi(id)
+		if err != nil {
+			return ref, fmt.Errorf("invalid layer id %q", id)
+		}
+		ref.Id = v
+		return ref, nil
+	}
+	if group, layer, ok := strings.Cut(s, "/"); ok {
+		if group == "" || layer == "" {
+			return ref, fmt.Errorf("invalid layer %q", s)
+		}
+		ref.Group = group
+		s = layer
+		if s == "*" {
+			ref.All = true
+			return ref, nil
+		}
+	}
+	if v, err := strconv.Atoi(s); err == nil {
+		if v < 1 {
+			return ref, fmt.Errorf("layers start at 1, got %d", v)
+		}
+		ref.Index = v
+		return ref, nil
+	}
+	ref.Name = s
+	return ref, nil
+}
+
+func (ref LayerRef) String() string {
+	var s string
+	switch {
+	case ref.Id != 0:
+		return fmt.Sprintf("id:%d", ref.Id)
+	case ref.All:
+		s = "*"
+	case ref.Index != 0:
+		s = strconv.Itoa(ref.Index)
+	default:
+		s = ref.Name
+	}
+	if ref.Group != "" {
+		return ref.Group + "/" + s
+	}
+	return s
+}
+
+// Layer returns the layer at a 1 indexed position
+func (c Composition) Layer(index int) (Layer, error) {
+	if index < 1 || index > len(c.Layers) {
+		return Layer{}, fmt.Errorf("layer %d out of range, composition has %d layers", index, len(c.Layers))
+	}
+	return c.Layers[index-1], nil
+}
+
+// ResolveLayers finds every layer ref points to. Only refs to a whole group
+// can return more than one layer.
+func (c Composition) ResolveLayers(ref LayerRef) ([]Layer, error) {
+	if !ref.All {
+		_, layer, err := c.ResolveLayer(ref)
+		if err != nil {
+			return nil, err
+		}
+		return []Layer{layer}, nil
+	}
+	group, err := c.GroupByName(ref.Group)
+	if err != nil {
+		return nil, err
+	}
+	if len(group.Layers) == 0 {
+		return nil, fmt.Errorf("layer group %q has no layers", ref.Group)
+	}
+	return group.Layers, nil
+}
+
+// ResolveLayer finds the layer ref points to, and its 1 indexed position in
+// the composition
+func (c Composition) ResolveLayer(ref LayerRef) (int, Layer, error) {
+	if ref.All {
+		return 0, Layer{}, fmt.Errorf("%s is more than one layer", ref)
+	}
+	if ref.Id != 0 {
+		idx, layer, ok := c.LayerById(ref.Id)
+		if !ok {
+			return 0, Layer{}, fmt.Errorf("no layer with id %d", ref.Id)
+		}
+		return idx, layer, nil
+	}
+
+	candidates := c.Layers
+	if ref.Group != "" {
+		group, err := c.GroupByName(ref.Group)
+		if err != nil {
+			return 0, Layer{}, err
+		}
+		candidates = group.Layers
+	}
+
+	var found []Layer
+	if ref.Index != 0 {
+		if ref.Index > len(candidates) {
+			return 0, Layer{}, fmt.Errorf("layer %s out of range, there are %d layers", ref, len(candidates))
+		}
+		found = append(found, candidates[ref.Index-1])
+	} else {
+		for _, layer := range candidates {
+			if layer.Name.Value == ref.Name {
+				found = append(found, layer)
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		return 0, Layer{}, fmt.Errorf("no layer named %q", ref.String())
+	case 1:
+	default:
+		return 0, Layer{}, fmt.Errorf("%d layers are named %q, use the layer number or id instead", len(found), ref.String())
+	}
+	idx, layer, ok := c.LayerById(found[0].Id)
+	if !ok {
+		return 0, Layer{}, fmt.Errorf("layer %s is in a group but not the composition", ref)
+	}
+	return idx, layer, nil
+}
+
+// GroupByName finds a layer group by name
+func (c Composition) GroupByName(name string) (LayerGroup, error) {
+	var found []LayerGroup
+	for _, group := range c.Layergroups {
+		if group.Name.Value == name {
+			found = append(found, group)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return LayerGroup{}, fmt.Errorf("no layer group named %q", name)
+	case 1:
+		return found[0], nil
+	}
+	return LayerGroup{}, fmt.Errorf("%d layer groups are named %q", len(found), name)
+}
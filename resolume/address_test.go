@@ -0,0 +1,147 @@
+package resolume_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bmurray/resolumeconverter/resolume"
+)
+
+func TestParseLayerRef(t *testing.T) {
+	tests := []struct {
+		s    string
+		want resolume.LayerRef
+		ok   bool
+	}{
+		{"3", resolume.LayerRef{Index: 3}, true},
+		{"id:1234", resolume.LayerRef{Id: 1234}, true},
+		{"Deck 1", resolume.LayerRef{Name: "Deck 1"}, true},
+		{"Music Videos/Deck 1", resolume.LayerRef{Group: "Music Videos", Name: "Deck 1"}, true},
+		{"Music Videos/2", resolume.LayerRef{Group: "Music Videos", Index: 2}, true},
+		{"Music Videos/*", resolume.LayerRef{Group: "Music Videos", All: true}, true},
+		// Only the first slash splits
+		{"AC/DC/Deck 1", resolume.LayerRef{Group: "AC", Name: "DC/Deck 1"}, true},
+		{"0", resolume.LayerRef{}, false},
+		{"-1", resolume.LayerRef{}, false},
+		{"Music Videos/0", resolume.LayerRef{}, false},
+		{"", resolume.LayerRef{}, false},
+		{"id:", resolume.LayerRef{}, false},
+		{"id:abc", resolume.LayerRef{}, false},
+		{"/Deck 1", resolume.LayerRef{}, false},
+		{"Music Videos/", resolume.LayerRef{}, false},
+	}
+	for _, tt := range tests {
+		got, err := resolume.ParseLayerRef(tt.s)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseLayerRef(%q) error %v, want ok %v", tt.s, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLayerRef(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+		if got.String() != tt.s {
+			t.Errorf("ParseLayerRef(%q).String() = %q", tt.s, got.String())
+		}
+	}
+}
+
+func layer(id int, name string) resolume.Layer {
+	return resolume.Layer{Id: id, Name: resolume.ParamString{Value: name}}
+}
+
+func group(id int, name string, layers ...resolume.Layer) resolume.LayerGroup {
+	return resolume.LayerGroup{Id: id, Name: resolume.ParamString{Value: name}, Layers: layers}
+}
+
+func TestResolveLayers(t *testing.T) {
+	// Grouped layers are listed in the composition and in their group
+	comp := resolume.Composition{
+		Layers: []resolume.Layer{
+			layer(10, "Background"),
+			layer(20, "Deck 1"),
+			layer(30, "Deck 2"),
+			layer(40, "Deck 1"),
+			layer(50, "Deck 3"),
+		},
+		Layergroups: []resolume.LayerGroup{
+			group(100, "Music Videos", layer(40, "Deck 1"), layer(50, "Deck 3")),
+			group(200, "Empty"),
+			group(300, "Twice"),
+			group(400, "Twice"),
+		},
+	}
+	tests := []struct {
+		ref  string
+		want []int
+	}{
+		{"1", []int{10}},
+		{"5", []int{50}},
+		{"6", nil},
+		{"id:30", []int{30}},
+		{"id:99", nil},
+		{"Background", []int{10}},
+		{"Deck 2", []int{30}},
+		{"Nowhere", nil},
+		// Two layers have this name
+		{"Deck 1", nil},
+		{"Music Videos/Deck 1", []int{40}},
+		{"Music Videos/Deck 2", nil},
+		{"Music Videos/1", []int{40}},
+		{"Music Videos/2", []int{50}},
+		{"Music Videos/3", nil},
+		{"Music Videos/*", []int{40, 50}},
+		{"Empty/*", nil},
+		{"Empty/1", nil},
+		{"Nope/1", nil},
+		{"Nope/*", nil},
+		{"Twice/*", nil},
+	}
+	for _, tt := range tests {
+		ref, err := resolume.ParseLayerRef(tt.ref)
+		if err != nil {
+			t.Fatalf("ParseLayerRef(%q): %v", tt.ref, err)
+		}
+		layers, err := comp.ResolveLayers(ref)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s resolved to %d layers, want an error", tt.ref, len(layers))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.ref, err)
+			continue
+		}
+		var got []int
+		for _, l := range layers {
+			got = append(got, l.Id)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s resolved to ids %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+
+	// The position is in the composition, not the group
+	idx, l, err := comp.ResolveLayer(resolume.LayerRef{Group: "Music Videos", Index: 2})
+	if err != nil || idx != 5 || l.Id != 50 {
+		t.Errorf("got layer %d id %d, %v, want layer 5 id 50", idx, l.Id, err)
+	}
+	if _, _, err := comp.ResolveLayer(resolume.LayerRef{Group: "Music Videos", All: true}); err == nil {
+		t.Error("resolved a whole group to one layer")
+	}
+}
+
+func TestCompositionLayer(t *testing.T) {
+	comp := resolume.Composition{Layers: []resolume.Layer{layer(10, "Background"), layer(20, "Deck 1")}}
+	for _, index := range []int{0, 3, -1} {
+		if _, err := comp.Layer(index); err == nil {
+			t.Errorf("got layer %d of 2", index)
+		}
+	}
+	if l, err := comp.Layer(2); err != nil || l.Id != 20 {
+		t.Errorf("got layer 2 id %d, %v", l.Id, err)
+	}
+}
@@ -0,0 +1,218 @@
+package resolume
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	ValueTypeString  ValueType = "ParamString"
+	ValueTypeBoolean ValueType = "ParamBoolean"
+	ValueTypeRange   ValueType = "ParamRange"
+	ValueTypeChoice  ValueType = "ParamChoice"
+	ValueTypeState   ValueType = "ParamState"
+	ValueTypeEvent   ValueType = "ParamEvent"
+)
+
+// Param is implemented by every typed Resolume parameter.
+type Param interface {
+	ParamId() int
+	ParamType() ValueType
+	// valueType is the valuetype the parameter was decoded with, if any
+	valueType() ValueType
+	// update returns the body Resolume expects when changing the parameter
+	update() any
+}
+
+type ParamString struct {
+	Id        int       `json:"id,omitempty"`
+	ValueType ValueType `json:"valuetype"`
+	Value     string    `json:"value"`
+}
+
+func (p ParamString) ParamId() int         { return p.Id }
+func (p ParamString) ParamType() ValueType { return ValueTypeString }
+func (p ParamString) valueType() ValueType { return p.ValueType }
+func (p ParamString) update() any {
+	return struct {
+		Value string `json:"value"`
+	}{p.Value}
+}
+
+type ParamBoolean struct {
+	Id        int       `json:"id,omitempty"`
+	ValueType ValueType `json:"valuetype"`
+	Value     bool      `json:"value"`
+}
+
+func (p ParamBoolean) ParamId() int         { return p.Id }
+func (p ParamBoolean) ParamType() ValueType { return ValueTypeBoolean }
+func (p ParamBoolean) valueType() ValueType { return p.ValueType }
+func (p ParamBoolean) update() any {
+	return struct {
+		Value bool `json:"value"`
+	}{p.Value}
+}
+
+type ParamRange struct {
+	Id        int       `json:"id,omitempty"`
+	ValueType ValueType `json:"valuetype"`
+	Value     float64   `json:"value"`
+	Min       float64   `json:"min,omitempty"`
+	Max       float64   `json:"max,omitempty"`
+}
+
+func (p ParamRange) ParamId() int         { return p.Id }
+func (p ParamRange) ParamType() ValueType { return ValueTypeRange }
+func (p ParamRange) valueType() ValueType { return p.ValueType }
+func (p ParamRange) update() any {
+	return struct {
+		Value float64 `json:"value"`
+	}{p.Value}
+}
+
+type ParamChoice struct {
+	Id        int       `json:"id,omitempty"`
+	ValueType ValueType `json:"valuetype"`
+	Value     string    `json:"value"`
+	Index     int       `json:"index"`
+	Options   []string  `json:"options,omitempty"`
+}
+
+func (p ParamChoice) ParamId() int         { return p.Id }
+func (p ParamChoice) ParamType() ValueType { return ValueTypeChoice }
+func (p ParamChoice) valueType() ValueType { return p.ValueType }
+func (p ParamChoice) update() any {
+	return struct {
+		Value string `json:"value"`
+		Index int    `json:"index"`
+	}{p.Value, p.Index}
+}
+
+// IndexOf returns the index of the named option
+func (p ParamChoice) IndexOf(option string) (int, bool) {
+	for i, o := range p.Options {
+		if o == option {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// ParamState is a read-only choice, such as a clip's connected state
+type ParamState struct {
+	Id        int       `json:"id,omitempty"`
+	ValueType ValueType `json:"valuetype"`
+	Value     string    `json:"value"`
+	Index     int       `json:"index"`
+	Options   []string  `json:"options,omitempty"`
+}
+
+func (p ParamState) ParamId() int         { return p.Id }
+func (p ParamState) ParamType() ValueType { return ValueTypeState }
+func (p ParamState) valueType() ValueType { return p.ValueType }
+func (p ParamState) update() any {
+	return struct {
+		Value string `json:"value"`
+		Index int    `json:"index"`
+	}{p.Value, p.Index}
+}
+
+// ParamEvent is a trigger, such as a button. Value is true while pressed.
+type ParamEvent struct {
+	Id        int       `json:"id,omitempty"`
+	ValueType ValueType `json:"valuetype"`
+	Value     bool      `json:"value"`
+}
+
+func (p ParamEvent) ParamId() int         { return p.Id }
+func (p ParamEvent) ParamType() ValueType { return ValueTypeEvent }
+func (p ParamEvent) valueType() ValueType { return p.ValueType }
+func (p ParamEvent) update() any {
+	return struct {
+		Value bool `json:"value"`
+	}{p.Value}
+}
+
+// DecodeParam decodes raw JSON into the requested parameter type. It fails if
+// the JSON declares a different valuetype.
+func DecodeParam[P Param](raw json.RawMessage) (P, error) {
+	var p P
+	if len(raw) == 0 {
+		return p, fmt.Errorf("empty parameter")
+	}
+	err := json.Unmarshal(raw, &p)
+	if err != nil {
+		return p, err
+	}
+	if vt := p.valueType(); vt != "" && vt != p.ParamType() {
+		return p, fmt.Errorf("parameter is %s, not %s", vt, p.ParamType())
+	}
+	return p, nil
+}
+
+// EncodeParam encodes a parameter, filling in the valuetype if it is missing
+func EncodeParam[P Param](p P) (json.RawMessage, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if vt, ok := m["valuetype"]; !ok || string(vt) == `""` {
+		m["valuetype"], _ = json.Marshal(p.ParamType())
+	}
+	return json.Marshal(m)
+}
+
+// DecodeAnyParam decodes a parameter whose type is only known from its
+// valuetype field.
+func DecodeAnyParam(raw json.RawMessage) (Param, error) {
+	var head struct {
+		ValueType ValueType `json:"valuetype"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, err
+	}
+	switch head.ValueType {
+	case ValueTypeString:
+		return DecodeParam[ParamString](raw)
+	case ValueTypeBoolean:
+		return DecodeParam[ParamBoolean](raw)
+	case ValueTypeRange:
+		return DecodeParam[ParamRange](raw)
+	case ValueTypeChoice:
+		return DecodeParam[ParamChoice](raw)
+	case ValueTypeState:
+		return DecodeParam[ParamState](raw)
+	case ValueTypeEvent:
+		return DecodeParam[ParamEvent](raw)
+	}
+	return nil, fmt.Errorf("unknown parameter type %q", head.ValueType)
+}
+
+// Params is a set of named parameters whose types vary, such as a
+// dashboard or transport controls.
+type Params map[string]json.RawMessage
+
+// GetParam decodes the named parameter from ps
+func GetParam[P Param](ps Params, name string) (P, error) {
+	raw, ok := ps[name]
+	if !ok {
+		var p P
+		return p, fmt.Errorf("no parameter %q", name)
+	}
+	return DecodeParam[P](raw)
+}
+
+// SetParam encodes p into ps under name
+func SetParam[P Param](ps Params, name string, p P) error {
+	raw, err := EncodeParam(p)
+	if err != nil {
+		return err
+	}
+	ps[name] = raw
+	return nil
+}
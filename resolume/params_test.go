@@ -0,0 +1,128 @@
+package resolume_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/bmurray/resolumeconverter/resolume"
+)
+
+// roundTrip decodes raw as P, checks it against want, and checks that
+// encoding it again gives the same JSON
+func roundTrip[P resolume.Param](t *testing.T, raw string, want P) {
+	t.Helper()
+	got, err := resolume.DecodeParam[P](json.RawMessage(raw))
+	if err != nil {
+		t.Fatalf("decoding %s: %v", raw, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %s as %+v, want %+v", raw, got, want)
+	}
+	enc, err := resolume.EncodeParam(got)
+	if err != nil {
+		t.Fatalf("encoding %+v: %v", got, err)
+	}
+	var a, b any
+	json.Unmarshal([]byte(raw), &a)
+	json.Unmarshal(enc, &b)
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("encoded %s, want %s", enc, raw)
+	}
+}
+
+func TestParamRoundTrip(t *testing.T) {
+	roundTrip(t, `{"id":1,"valuetype":"ParamString","value":"Song"}`,
+		resolume.ParamString{Id: 1, ValueType: resolume.ValueTypeString, Value: "Song"})
+	roundTrip(t, `{"id":2,"valuetype":"ParamBoolean","value":true}`,
+		resolume.ParamBoolean{Id: 2, ValueType: resolume.ValueTypeBoolean, Value: true})
+	roundTrip(t, `{"id":3,"valuetype":"ParamRange","value":0.5,"min":-1,"max":1}`,
+		resolume.ParamRange{Id: 3, ValueType: resolume.ValueTypeRange, Value: 0.5, Min: -1, Max: 1})
+	roundTrip(t, `{"id":4,"valuetype":"ParamChoice","value":"Denon DJ","index":1,"options":["Timeline","Denon DJ"]}`,
+		resolume.ParamChoice{Id: 4, ValueType: resolume.ValueTypeChoice, Value: resolume.TransportDenon, Index: 1, Options: []string{"Timeline", resolume.TransportDenon}})
+	roundTrip(t, `{"id":5,"valuetype":"ParamState","value":"Empty","index":0,"options":["Empty","Connected"]}`,
+		resolume.ParamState{Id: 5, ValueType: resolume.ValueTypeState, Value: "Empty", Options: []string{"Empty", "Connected"}})
+	roundTrip(t, `{"id":6,"valuetype":"ParamEvent","value":false}`,
+		resolume.ParamEvent{Id: 6, ValueType: resolume.ValueTypeEvent})
+	// Some choices only say which option is picked
+	roundTrip(t, `{"id":7,"valuetype":"ParamChoice","value":"","index":2}`,
+		resolume.ParamChoice{Id: 7, ValueType: resolume.ValueTypeChoice, Index: 2})
+}
+
+func TestDecodeParamWrongType(t *testing.T) {
+	raw := json.RawMessage(`{"id":1,"valuetype":"ParamChoice","value":"Denon DJ","index":4}`)
+	if _, err := resolume.DecodeParam[resolume.ParamString](raw); err == nil {
+		t.Error("decoded a choice as a string")
+	}
+	if _, err := resolume.DecodeParam[resolume.ParamChoice](nil); err == nil {
+		t.Error("decoded an empty parameter")
+	}
+	// No valuetype at all is taken at its word
+	p, err := resolume.DecodeParam[resolume.ParamString](json.RawMessage(`{"value":"Song"}`))
+	if err != nil || p.Value != "Song" {
+		t.Errorf("got %+v, %v", p, err)
+	}
+}
+
+func TestEncodeParamFillsValueType(t *testing.T) {
+	raw, err := resolume.EncodeParam(resolume.ParamRange{Value: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	json.Unmarshal(raw, &got)
+	if got["valuetype"] != string(resolume.ValueTypeRange) || got["value"] != 2.0 {
+		t.Errorf("got %s", raw)
+	}
+}
+
+func TestDecodeAnyParam(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want resolume.Param
+	}{
+		{`{"id":1,"valuetype":"ParamString","value":"Song"}`, resolume.ParamString{Id: 1, ValueType: resolume.ValueTypeString, Value: "Song"}},
+		{`{"id":2,"valuetype":"ParamBoolean","value":true}`, resolume.ParamBoolean{Id: 2, ValueType: resolume.ValueTypeBoolean, Value: true}},
+		{`{"id":3,"valuetype":"ParamRange","value":1}`, resolume.ParamRange{Id: 3, ValueType: resolume.ValueTypeRange, Value: 1}},
+		{`{"id":4,"valuetype":"ParamChoice","index":2}`, resolume.ParamChoice{Id: 4, ValueType: resolume.ValueTypeChoice, Index: 2}},
+		{`{"id":5,"valuetype":"ParamState","value":"Empty"}`, resolume.ParamState{Id: 5, ValueType: resolume.ValueTypeState, Value: "Empty"}},
+		{`{"id":6,"valuetype":"ParamEvent","value":true}`, resolume.ParamEvent{Id: 6, ValueType: resolume.ValueTypeEvent, Value: true}},
+	}
+	for _, tt := range tests {
+		got, err := resolume.DecodeAnyParam(json.RawMessage(tt.raw))
+		if err != nil {
+			t.Errorf("%s: %v", tt.raw, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.raw, got, tt.want)
+		}
+	}
+
+	for _, raw := range []string{`{"id":7,"valuetype":"ParamColor","value":"#ff0000"}`, `{"id":8,"value":1}`, `not json`} {
+		if p, err := resolume.DecodeAnyParam(json.RawMessage(raw)); err == nil {
+			t.Errorf("%s: decoded as %#v", raw, p)
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	ps := make(resolume.Params)
+	err := resolume.SetParam(ps, "target", resolume.ParamChoice{Value: resolume.TargetDenon, Index: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := resolume.GetParam[resolume.ParamChoice](ps, "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Value != resolume.TargetDenon || got.Index != 4 || got.ValueType != resolume.ValueTypeChoice {
+		t.Errorf("got %+v", got)
+	}
+	if _, err := resolume.GetParam[resolume.ParamRange](ps, "target"); err == nil {
+		t.Error("got a choice as a range")
+	}
+	if _, err := resolume.GetParam[resolume.ParamChoice](ps, "missing"); err == nil {
+		t.Error("got a parameter that isn't there")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -12,6 +13,8 @@ import (
 	"strings"
 )
 
+var ErrNoEmptyClip = errors.New("no empty clips found")
+
 type Resolume struct {
 	baseUrl *url.URL
 
@@ -55,6 +58,9 @@ func (r Resolume) GetComposition(ctx context.Context) (Composition, error) {
 	err = json.NewDecoder(resp.Body).Decode(&v)
 	return v, err
 }
+
+// FindEmptyClip returns the first empty clip between two layers, inclusive.
+// Layers are 1 indexed, starting at the bottom.
 func (r Resolume) FindEmptyClip(ctx context.Context, startLayer, endLayer int) (layer_id int, clip_id Clip, err error) {
 	if startLayer > endLayer {
 		return 0, Clip{}, fmt.Errorf("startLayer must be less than endLayer")
@@ -63,19 +69,166 @@ func (r Resolume) FindEmptyClip(ctx context.Context, startLayer, endLayer int) (
 	if err != nil {
 		return 0, Clip{}, err
 	}
+	if startLayer < 1 {
+		return 0, Clip{}, fmt.Errorf("layers start at 1, got %d", startLayer)
+	}
 	if len(comp.Layers) < endLayer {
 		return 0, Clip{}, fmt.Errorf("endLayer is greater than number of layers")
 	}
 
 	for i := startLayer; i <= endLayer; i++ {
-		layer := comp.Layers[i]
+		layer := comp.Layers[i-1]
 		for _, clip := range layer.Clips {
 			if clip.Connected.Value == "Empty" {
 				return layer.Id, clip, nil
 			}
 		}
 	}
-	return 0, Clip{}, fmt.Errorf("no empty clips found")
+	return 0, Clip{}, ErrNoEmptyClip
+}
+
+// AddColumn adds a column to the end of the composition, giving every layer
+// another empty clip.
+func (r Resolume) AddColumn(ctx context.Context) error {
+	return r.post(ctx, "composition/columns/add")
+}
+
+// AddLayer adds a layer to the top of the composition and returns it
+func (r Resolume) AddLayer(ctx context.Context) (Layer, error) {
+	return r.addLayer(ctx, "composition/layers/add")
+}
+
+// AddLayerToGroup adds a layer to the top of a layer group and returns it.
+// Groups are 1 indexed.
+func (r Resolume) AddLayerToGroup(ctx context.Context, group int) (Layer, error) {
+	return r.addLayer(ctx, fmt.Sprintf("composition/layergroups/%d/layers/add", group))
+}
+
+// addLayer posts to path and finds the new layer by comparing the layers
+// before and after, as Resolume doesn't say which one it made.
+func (r Resolume) addLayer(ctx context.Context, path string) (Layer, error) {
+	before, err := r.GetComposition(ctx)
+	if err != nil {
+		return Layer{}, err
+	}
+	err = r.post(ctx, path)
+	if err != nil {
+		return Layer{}, err
+	}
+	after, err := r.GetComposition(ctx)
+	if err != nil {
+		return Layer{}, err
+	}
+	for _, layer := range after.Layers {
+		if _, _, ok := before.LayerById(layer.Id); !ok {
+			return layer, nil
+		}
+	}
+	return Layer{}, fmt.Errorf("new layer not found in composition")
+}
+
+// GetLayerGroups returns the layer groups, bottom first
+func (r Resolume) GetLayerGroups(ctx context.Context) ([]LayerGroup, error) {
+	comp, err := r.GetComposition(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return comp.Layergroups, nil
+}
+
+// AddLayerGroup creates an empty layer group with the given name and
+// returns it
+func (r Resolume) AddLayerGroup(ctx context.Context, name string) (LayerGroup, error) {
+	before, err := r.GetComposition(ctx)
+	if err != nil {
+		return LayerGroup{}, err
+	}
+	err = r.post(ctx, "composition/layergroups/add")
+	if err != nil {
+		return LayerGroup{}, err
+	}
+	after, err := r.GetComposition(ctx)
+	if err != nil {
+		return LayerGroup{}, err
+	}
+	known := make(map[int]bool)
+	for _, g := range before.Layergroups {
+		known[g.Id] = true
+	}
+	for _, g := range after.Layergroups {
+		if known[g.Id] {
+			continue
+		}
+		g.Name.Value = name
+		err = r.SetLayerGroupParams(ctx, g.Id, map[string]Param{"name": g.Name})
+		return g, err
+	}
+	return LayerGroup{}, fmt.Errorf("new layer group not found in composition")
+}
+
+// SetLayerGroupParams changes the named parameters of a layer group
+func (r Resolume) SetLayerGroupParams(ctx context.Context, groupId int, params map[string]Param) error {
+	val := make(map[string]any, len(params))
+	for name, p := range params {
+		val[name] = p.update()
+	}
+	b := bytes.Buffer{}
+	err := json.NewEncoder(&b).Encode(val)
+	if err != nil {
+		return err
+	}
+	u, err := r.baseUrl.Parse(fmt.Sprintf("composition/layergroups/by-id/%d", groupId))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), &b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// MoveLayerToGroup moves a layer into a layer group. Groups are 1 indexed.
+func (r Resolume) MoveLayerToGroup(ctx context.Context, layerId, group int) error {
+	return r.postBody(ctx, fmt.Sprintf("composition/layergroups/%d/layers/move", group), fmt.Sprintf("/composition/layers/by-id/%d", layerId))
+}
+
+func (r Resolume) post(ctx context.Context, path string) error {
+	return r.postBody(ctx, path, "")
+}
+
+func (r Resolume) postBody(ctx context.Context, path, body string) error {
+	u, err := r.baseUrl.Parse(path)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "text/plain")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
 }
 func (r Resolume) OpenClip(ctx context.Context, clipId int, filePath string) error {
 
@@ -133,6 +286,53 @@ func (r Resolume) GetClip(ctx context.Context, clipId int) (Clip, error) {
 	err = json.NewDecoder(resp.Body).Decode(&v)
 	return v, err
 }
+
+// GetClipParams fetches a clip as raw parameters, for when the parameter name
+// is only known at runtime.
+func (r Resolume) GetClipParams(ctx context.Context, clipId int) (Params, error) {
+	var v Params
+	u, err := r.baseUrl.Parse(fmt.Sprintf("composition/clips/by-id/%d", clipId))
+	if err != nil {
+		return v, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return v, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return v, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return v, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&v)
+	return v, err
+}
+
+// SetChoice sets a ParamChoice on a clip by the name of the option. The index
+// is looked up from the options the clip currently reports, since it changes
+// between Arena versions.
+func (r Resolume) SetChoice(ctx context.Context, clipId int, param, option string) error {
+	params, err := r.GetClipParams(ctx, clipId)
+	if err != nil {
+		return err
+	}
+	choice, err := GetParam[ParamChoice](params, param)
+	if err != nil {
+		return fmt.Errorf("clip %d: %w", clipId, err)
+	}
+	idx, ok := choice.IndexOf(option)
+	if !ok {
+		return fmt.Errorf("clip %d: %s has no option %q; valid options are %q", clipId, param, option, choice.Options)
+	}
+	choice.Value = option
+	choice.Index = idx
+	return r.SetClipParams(ctx, clipId, map[string]Param{param: choice})
+}
 func (r Resolume) SetClip(ctx context.Context, clipId int, clip Clip) error {
 	b := bytes.Buffer{}
 	err := json.NewEncoder(&b).Encode(clip)
@@ -186,6 +386,16 @@ func (r Resolume) SetClipRaw(ctx context.Context, clipId int, val map[string]any
 
 	return nil
 }
+
+// SetClipParams changes the named parameters of a clip, leaving everything
+// else untouched.
+func (r Resolume) SetClipParams(ctx context.Context, clipId int, params map[string]Param) error {
+	val := make(map[string]any, len(params))
+	for name, p := range params {
+		val[name] = p.update()
+	}
+	return r.SetClipRaw(ctx, clipId, val)
+}
 func (r Resolume) SetClipByLayerClipRaw(ctx context.Context, layerId, clipId int, val map[string]any) error {
 	b := bytes.Buffer{}
 	err := json.NewEncoder(&b).Encode(val)
@@ -247,7 +457,7 @@ func (r Resolume) GetLayers(ctx context.Context) ([]Layer, error) {
 }
 func (r Resolume) GetThumbnail(ctx context.Context, clipId int) (io.ReadCloser, error) {
 
-	u, err := r.baseUrl.Parse(fmt.Sprintf("composition/clips/by-id/%s/thumbnail", clipId))
+	u, err := r.baseUrl.Parse(fmt.Sprintf("composition/clips/by-id/%d/thumbnail", clipId))
 	if err != nil {
 		return nil, err
 	}
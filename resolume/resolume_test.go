@@ -0,0 +1,225 @@
+package resolume_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bmurray/resolumeconverter/resolume"
+	"github.com/bmurray/resolumeconverter/resolume/resolumetest"
+)
+
+func newServer(t *testing.T, comp resolume.Composition) (*resolumetest.Server, *resolume.Resolume) {
+	t.Helper()
+	srv := resolumetest.NewServer(comp)
+	t.Cleanup(srv.Close)
+	return srv, resolume.NewResolume(srv.BaseURL())
+}
+
+// fill marks a clip as having something loaded
+func fill(clip *resolume.Clip) {
+	clip.Connected.Value = resolumetest.ConnectedOptions[1]
+	clip.Connected.Index = 1
+}
+
+func TestFindEmptyClip(t *testing.T) {
+	comp := resolumetest.NewComposition(3, 2)
+	fill(&comp.Layers[1].Clips[0])
+	_, r := newServer(t, comp)
+
+	tests := []struct {
+		name       string
+		start, end int
+		layer      int
+		clip       int
+		err        bool
+	}{
+		{"first layer", 1, 3, comp.Layers[0].Id, comp.Layers[0].Clips[0].Id, false},
+		{"skips full clips", 2, 2, comp.Layers[1].Id, comp.Layers[1].Clips[1].Id, false},
+		{"last layer", 3, 3, comp.Layers[2].Id, comp.Layers[2].Clips[0].Id, false},
+		{"backwards", 2, 1, 0, 0, true},
+		{"layer 0", 0, 1, 0, 0, true},
+		{"past the top", 1, 4, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layer, clip, err := r.FindEmptyClip(context.Background(), tt.start, tt.end)
+			if tt.err {
+				if err == nil {
+					t.Errorf("got layer %d clip %d, want an error", layer, clip.Id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if layer != tt.layer || clip.Id != tt.clip {
+				t.Errorf("got layer %d clip %d, want layer %d clip %d", layer, clip.Id, tt.layer, tt.clip)
+			}
+		})
+	}
+}
+
+func TestFindEmptyClipFull(t *testing.T) {
+	comp := resolumetest.NewComposition(2, 2)
+	for l := range comp.Layers {
+		for c := range comp.Layers[l].Clips {
+			fill(&comp.Layers[l].Clips[c])
+		}
+	}
+	_, r := newServer(t, comp)
+
+	_, _, err := r.FindEmptyClip(context.Background(), 1, 2)
+	if !errors.Is(err, resolume.ErrNoEmptyClip) {
+		t.Errorf("got %v, want ErrNoEmptyClip", err)
+	}
+}
+
+func TestOpenClip(t *testing.T) {
+	comp := resolumetest.NewComposition(1, 2)
+	srv, r := newServer(t, comp)
+	file := filepath.Join(t.TempDir(), "Some Song.mov")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	id := comp.Layers[0].Clips[1].Id
+	if err := r.OpenClip(ctx, id, file); err != nil {
+		t.Fatal(err)
+	}
+	clip, err := r.GetClip(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clip.Name.Value != "Some Song" {
+		t.Errorf("clip is named %q, want Some Song", clip.Name.Value)
+	}
+	if info := clip.Video.FileInfo; info.Path != file || !info.Exists {
+		t.Errorf("clip has file %q exists %v, want %q", info.Path, info.Exists, file)
+	}
+	if clip.Connected.Value == "Empty" {
+		t.Error("clip is still empty")
+	}
+	if other := srv.Composition().Layers[0].Clips[0]; other.Connected.Value != "Empty" {
+		t.Error("another clip was opened too")
+	}
+
+	selected, err := r.GetSelectedClip(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selected.Id != id {
+		t.Errorf("selected clip %d, want %d", selected.Id, id)
+	}
+
+	if err := r.OpenClip(ctx, 9999, file); err == nil {
+		t.Error("opened a clip that doesn't exist")
+	}
+}
+
+func TestSetClipParams(t *testing.T) {
+	comp := resolumetest.NewComposition(1, 1)
+	_, r := newServer(t, comp)
+	ctx := context.Background()
+	id := comp.Layers[0].Clips[0].Id
+
+	err := r.SetClipParams(ctx, id, map[string]resolume.Param{
+		"name": resolume.ParamString{Value: "Renamed"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetChoice(ctx, id, "transporttype", resolume.TransportDenon); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetChoice(ctx, id, "target", resolume.TargetDenon); err != nil {
+		t.Fatal(err)
+	}
+
+	clip, err := r.GetClip(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clip.Name.Value != "Renamed" {
+		t.Errorf("name is %q, want Renamed", clip.Name.Value)
+	}
+	if clip.TransportType.Value != resolume.TransportDenon || clip.TransportType.Index != 4 {
+		t.Errorf("transport is %q index %d, want Denon DJ index 4", clip.TransportType.Value, clip.TransportType.Index)
+	}
+	if clip.Target.Value != resolume.TargetDenon {
+		t.Errorf("target is %q", clip.Target.Value)
+	}
+	// Untouched parameters keep their ids
+	if clip.Name.Id != comp.Layers[0].Clips[0].Name.Id {
+		t.Errorf("name id changed from %d to %d", comp.Layers[0].Clips[0].Name.Id, clip.Name.Id)
+	}
+
+	if err := r.SetChoice(ctx, id, "target", "Nowhere"); err == nil {
+		t.Error("set a choice to an option it doesn't have")
+	}
+}
+
+// countIds counts how often each id appears anywhere in v
+func countIds(t *testing.T, v any) map[int]int {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tree any
+	json.Unmarshal(b, &tree)
+	counts := make(map[int]int)
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, e := range v {
+				if id, ok := e.(float64); ok && k == "id" {
+					counts[int(id)]++
+					continue
+				}
+				walk(e)
+			}
+		case []any:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(tree)
+	return counts
+}
+
+func TestSetComposition(t *testing.T) {
+	srv, r := newServer(t, resolumetest.NewComposition(1, 1))
+	ctx := context.Background()
+
+	// A bigger composition has ids past the ones the server has handed out,
+	// and the last of them belong to parameters, not clips
+	srv.SetComposition(resolumetest.NewComposition(2, 4))
+	if err := r.AddColumn(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.AddLayer(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.AddLayerGroup(ctx, "Group"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.GetComposition(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Layers) != 3 || len(got.Columns) != 5 || len(got.Layergroups) != 1 {
+		t.Fatalf("got %d layers, %d columns and %d groups, want 3, 5 and 1", len(got.Layers), len(got.Columns), len(got.Layergroups))
+	}
+	for id, n := range countIds(t, got) {
+		if n > 1 {
+			t.Errorf("id %d is used %d times", id, n)
+		}
+	}
+}
@@ -0,0 +1,576 @@
+// Package resolumetest emulates the parts of the Resolume REST API that the
+// resolume client uses, backed by an in-memory composition. It is meant for
+// tests and for working on the converter without Arena running.
+package resolumetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bmurray/resolumeconverter/resolume"
+)
+
+const apiPrefix = "/api/v1/"
+
+var (
+	ConnectedOptions     = []string{"Empty", "Disconnected", "Previewing", "Connected", "Connected & previewing"}
+	TransportTypeOptions = []string{"Timeline", "BPM Sync", "SMPTE Timecode", "Pioneer DJ Link", resolume.TransportDenon}
+	TargetOptions        = []string{"Own Layer", "Active Layer", "Selected Layer", "Selected Layer (Replace)", resolume.TargetDenon}
+)
+
+// Handler serves the fake API. The composition can be inspected and changed
+// while it is serving.
+type Handler struct {
+	mu       sync.Mutex
+	comp     resolume.Composition
+	nextId   int
+	selected int
+
+	log *slog.Logger
+}
+
+func NewHandler(comp resolume.Composition) *Handler {
+	h := &Handler{
+		comp:   comp,
+		nextId: 1,
+		log:    slog.Default().With("pkg", "resolumetest"),
+	}
+	h.seenIds(comp)
+	return h
+}
+
+// Server is a Handler running on a local httptest server
+type Server struct {
+	*Handler
+	*httptest.Server
+}
+
+// NewServer starts a fake Resolume serving comp. Close it when done.
+func NewServer(comp resolume.Composition) *Server {
+	h := NewHandler(comp)
+	return &Server{
+		Handler: h,
+		Server:  httptest.NewServer(h),
+	}
+}
+
+// BaseURL is the URL to hand to resolume.NewResolume
+func (s *Server) BaseURL() *url.URL {
+	u, err := url.Parse(s.Server.URL + apiPrefix)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// NewComposition builds an empty composition with the given number of layers
+// and columns
+func NewComposition(layers, columns int) resolume.Composition {
+	ids := 1
+	id := func() int {
+		ids++
+		return ids
+	}
+	comp := resolume.Composition{
+		Name: resolume.ParamString{Id: id(), ValueType: resolume.ValueTypeString, Value: "Composition"},
+	}
+	for c := 0; c < columns; c++ {
+		comp.Columns = append(comp.Columns, newColumn(id, c+1))
+	}
+	for l := 0; l < layers; l++ {
+		comp.Layers = append(comp.Layers, newLayer(id, l+1, columns))
+	}
+	return comp
+}
+
+func newColumn(id func() int, n int) resolume.Column {
+	return resolume.Column{
+		Id:   id(),
+		Name: resolume.ParamString{Id: id(), ValueType: resolume.ValueTypeString, Value: fmt.Sprintf("Column %d", n)},
+	}
+}
+
+func newLayer(id func() int, n, columns int) resolume.Layer {
+	layer := resolume.Layer{
+		Id:   id(),
+		Name: resolume.ParamString{Id: id(), ValueType: resolume.ValueTypeString, Value: fmt.Sprintf("Layer %d", n)},
+	}
+	for c := 0; c < columns; c++ {
+		layer.Clips = append(layer.Clips, NewClip(id))
+	}
+	return layer
+}
+
+// NewClip returns an empty clip, taking ids for it and its parameters from id
+func NewClip(id func() int) resolume.Clip {
+	return resolume.Clip{
+		Id:            id(),
+		Name:          resolume.ParamString{Id: id(), ValueType: resolume.ValueTypeString},
+		Connected:     resolume.ParamState{Id: id(), ValueType: resolume.ValueTypeState, Value: ConnectedOptions[0], Options: ConnectedOptions},
+		TransportType: resolume.ParamChoice{Id: id(), ValueType: resolume.ValueTypeChoice, Value: TransportTypeOptions[0], Options: TransportTypeOptions},
+		Target:        resolume.ParamChoice{Id: id(), ValueType: resolume.ValueTypeChoice, Value: TargetOptions[0], Options: TargetOptions},
+	}
+}
+
+// Composition returns a copy of the current composition
+func (h *Handler) Composition() resolume.Composition {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var v resolume.Composition
+	copyJSON(&v, h.comp)
+	return v
+}
+
+// SetComposition replaces the composition being served
+func (h *Handler) SetComposition(comp resolume.Composition) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.comp = comp
+	h.seenIds(comp)
+}
+
+// seenIds makes sure new ids don't clash with any id in comp: layers,
+// columns, groups, clips and every parameter
+func (h *Handler) seenIds(comp resolume.Composition) {
+	var v any
+	if err := copyJSON(&v, comp); err != nil {
+		h.log.Warn("Error reading ids", "error", err)
+		return
+	}
+	h.seenIdsIn(v)
+}
+
+func (h *Handler) seenIdsIn(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if id, ok := e.(float64); ok && k == "id" {
+				h.seenId(int(id))
+				continue
+			}
+			h.seenIdsIn(e)
+		}
+	case []any:
+		for _, e := range v {
+			h.seenIdsIn(e)
+		}
+	}
+}
+
+func (h *Handler) seenId(id int) {
+	if id >= h.nextId {
+		h.nextId = id + 1
+	}
+}
+
+func (h *Handler) id() int {
+	id := h.nextId
+	h.nextId++
+	return id
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, ok := strings.CutPrefix(r.URL.Path, apiPrefix)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	h.log.Debug("Request", "method", r.Method, "path", path)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Grouped layers are listed twice, keep the group's copy current
+	defer h.syncGroups()
+
+	switch {
+	case match(parts, "composition"):
+		h.serveComposition(w, r)
+	case match(parts, "composition", "clips", "selected"):
+		clip := h.clipById(h.selected)
+		if clip == nil {
+			http.NotFound(w, r)
+			return
+		}
+		h.serveClip(w, r, clip)
+	case match(parts, "composition", "clips", "by-id", "*"):
+		h.serveClip(w, r, h.clipById(atoi(parts[3])))
+	case match(parts, "composition", "clips", "by-id", "*", "open"):
+		h.serveOpen(w, r, h.clipById(atoi(parts[3])))
+	case match(parts, "composition", "clips", "by-id", "*", "thumbnail"):
+		h.serveThumbnail(w, r, h.clipById(atoi(parts[3])))
+	case match(parts, "composition", "layers", "*", "clips", "*"):
+		h.serveClip(w, r, h.clipByIndex(atoi(parts[2]), atoi(parts[4])))
+	case match(parts, "composition", "columns", "add"):
+		h.serveAddColumn(w, r)
+	case match(parts, "composition", "layers", "add"):
+		h.serveAddLayer(w, r, 0)
+	case match(parts, "composition", "layergroups", "*", "layers", "add"):
+		h.serveAddLayer(w, r, atoi(parts[2]))
+	case match(parts, "composition", "layergroups", "add"):
+		h.serveAddLayerGroup(w, r)
+	case match(parts, "composition", "layergroups", "by-id", "*"):
+		h.serveLayerGroup(w, r, atoi(parts[3]))
+	case match(parts, "composition", "layergroups", "*", "layers", "move"):
+		h.serveMoveLayer(w, r, atoi(parts[2]))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// match compares a split path to a pattern, where * matches any segment
+func match(parts []string, pattern ...string) bool {
+	if len(parts) != len(pattern) {
+		return false
+	}
+	for i, p := range pattern {
+		if p != "*" && p != parts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func atoi(s string) int {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+func (h *Handler) clipById(id int) *resolume.Clip {
+	for l := range h.comp.Layers {
+		for c := range h.comp.Layers[l].Clips {
+			if h.comp.Layers[l].Clips[c].Id == id {
+				return &h.comp.Layers[l].Clips[c]
+			}
+		}
+	}
+	return nil
+}
+
+// clipByIndex finds a clip the way the API addresses them; both are 1 based
+func (h *Handler) clipByIndex(layer, column int) *resolume.Clip {
+	if layer < 1 || layer > len(h.comp.Layers) {
+		return nil
+	}
+	clips := h.comp.Layers[layer-1].Clips
+	if column < 1 || column > len(clips) {
+		return nil
+	}
+	return &clips[column-1]
+}
+
+func (h *Handler) serveComposition(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, h.comp)
+}
+
+func (h *Handler) serveClip(w http.ResponseWriter, r *http.Request, clip *resolume.Clip) {
+	if clip == nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, clip)
+	case http.MethodPut:
+		update := make(map[string]json.RawMessage)
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := applyUpdate(clip, update); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) serveOpen(w http.ResponseWriter, r *http.Request, clip *resolume.Clip) {
+	if clip == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	u, err := url.Parse(strings.TrimSpace(string(body)))
+	if err != nil || u.Scheme != "file" {
+		http.Error(w, "expected a file:// url", http.StatusBadRequest)
+		return
+	}
+	_, statErr := os.Stat(u.Path)
+	base := filepath.Base(u.Path)
+
+	clip.Video.FileInfo = resolume.FileInfo{
+		Path:   u.Path,
+		Exists: statErr == nil,
+	}
+	clip.Name.Value = strings.TrimSuffix(base, filepath.Ext(base))
+	clip.Connected.Value = ConnectedOptions[1]
+	clip.Connected.Index = 1
+	h.selected = clip.Id
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) serveAddColumn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.comp.Columns = append(h.comp.Columns, newColumn(h.id, len(h.comp.Columns)+1))
+	for l := range h.comp.Layers {
+		h.comp.Layers[l].Clips = append(h.comp.Layers[l].Clips, NewClip(h.id))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveAddLayer adds a layer to the top of the composition, or to the top of
+// a layer group if group isn't 0
+func (h *Handler) serveAddLayer(w http.ResponseWriter, r *http.Request, group int) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if group < 0 || group > len(h.comp.Layergroups) {
+		http.NotFound(w, r)
+		return
+	}
+	layer := newLayer(h.id, len(h.comp.Layers)+1, len(h.comp.Columns))
+	pos := len(h.comp.Layers)
+	if group > 0 {
+		g := &h.comp.Layergroups[group-1]
+		pos = h.groupTop(g)
+		g.Layers = append(g.Layers, layer)
+	}
+	h.comp.Layers = append(h.comp.Layers[:pos], append([]resolume.Layer{layer}, h.comp.Layers[pos:]...)...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) serveAddLayerGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.comp.Layergroups = append(h.comp.Layergroups, resolume.LayerGroup{
+		Id:   h.id(),
+		Name: resolume.ParamString{Id: h.id(), ValueType: resolume.ValueTypeString, Value: fmt.Sprintf("Group %d", len(h.comp.Layergroups)+1)},
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) serveLayerGroup(w http.ResponseWriter, r *http.Request, id int) {
+	var group *resolume.LayerGroup
+	for g := range h.comp.Layergroups {
+		if h.comp.Layergroups[g].Id == id {
+			group = &h.comp.Layergroups[g]
+			break
+		}
+	}
+	if group == nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, group)
+	case http.MethodPut:
+		update := make(map[string]json.RawMessage)
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := applyUpdate(group, update); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveMoveLayer moves the layer named in the body, by its
+// /composition/layers/by-id/{id} path, into a group
+func (h *Handler) serveMoveLayer(w http.ResponseWriter, r *http.Request, group int) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if group < 1 || group > len(h.comp.Layergroups) {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	idStr, ok := strings.CutPrefix(strings.TrimSpace(string(body)), "/composition/layers/by-id/")
+	if !ok {
+		http.Error(w, "expected a layer path", http.StatusBadRequest)
+		return
+	}
+	pos, layer, ok := h.comp.LayerById(atoi(idStr))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Take it out of the composition and any group it's in
+	h.comp.Layers = append(h.comp.Layers[:pos-1], h.comp.Layers[pos:]...)
+	for g := range h.comp.Layergroups {
+		layers := h.comp.Layergroups[g].Layers[:0]
+		for _, gl := range h.comp.Layergroups[g].Layers {
+			if gl.Id != layer.Id {
+				layers = append(layers, gl)
+			}
+		}
+		h.comp.Layergroups[g].Layers = layers
+	}
+
+	// and put it on top of the group, or the top of the composition if the
+	// group is empty
+	g := &h.comp.Layergroups[group-1]
+	pos = h.groupTop(g)
+	g.Layers = append(g.Layers, layer)
+	h.comp.Layers = append(h.comp.Layers[:pos], append([]resolume.Layer{layer}, h.comp.Layers[pos:]...)...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// groupTop returns where in the composition a layer added to the top of g
+// goes. Groups are contiguous, so that's just above the group's top layer.
+func (h *Handler) groupTop(g *resolume.LayerGroup) int {
+	if len(g.Layers) == 0 {
+		return len(h.comp.Layers)
+	}
+	pos := 0
+	for _, gl := range g.Layers {
+		if i, _, ok := h.comp.LayerById(gl.Id); ok && i > pos {
+			pos = i
+		}
+	}
+	return pos
+}
+
+func (h *Handler) syncGroups() {
+	for g := range h.comp.Layergroups {
+		for l, gl := range h.comp.Layergroups[g].Layers {
+			if _, layer, ok := h.comp.LayerById(gl.Id); ok {
+				h.comp.Layergroups[g].Layers[l] = layer
+			}
+		}
+	}
+}
+
+func (h *Handler) serveThumbnail(w http.ResponseWriter, r *http.Request, clip *resolume.Clip) {
+	if clip == nil {
+		http.NotFound(w, r)
+		return
+	}
+	b := bytes.Buffer{}
+	if err := png.Encode(&b, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(b.Bytes())
+}
+
+// applyUpdate merges a partial object, as sent by the client, into v.
+// Parameters are merged field by field, so {"value": "x"} only changes the
+// value. Choices are kept consistent with their options.
+func applyUpdate[T any](v *T, update map[string]json.RawMessage) error {
+	current := make(map[string]json.RawMessage)
+	if err := copyJSON(&current, v); err != nil {
+		return err
+	}
+	for name, raw := range update {
+		var fields map[string]any
+		var existing map[string]any
+		if json.Unmarshal(raw, &fields) != nil || json.Unmarshal(current[name], &existing) != nil || existing == nil {
+			current[name] = raw
+			continue
+		}
+		for k, v := range fields {
+			existing[k] = v
+		}
+		if err := syncChoice(existing, fields); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		b, err := json.Marshal(existing)
+		if err != nil {
+			return err
+		}
+		current[name] = b
+	}
+	var updated T
+	if err := copyJSON(&updated, current); err != nil {
+		return err
+	}
+	*v = updated
+	return nil
+}
+
+func syncChoice(param, changed map[string]any) error {
+	options, ok := param["options"].([]any)
+	if !ok {
+		return nil
+	}
+	if value, ok := changed["value"].(string); ok {
+		for i, o := range options {
+			if o == value {
+				param["index"] = i
+				return nil
+			}
+		}
+		return fmt.Errorf("no option %q", value)
+	}
+	if index, ok := changed["index"].(float64); ok {
+		if int(index) < 0 || int(index) >= len(options) {
+			return fmt.Errorf("index %d out of range", int(index))
+		}
+		param["value"] = options[int(index)]
+	}
+	return nil
+}
+
+func copyJSON(dst, src any) error {
+	b, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -4,96 +4,138 @@ import "encoding/json"
 
 type Composition struct {
 	Audio            json.RawMessage `json:"audio"`
-	Bypassed         json.RawMessage `json:"bypassed"`
-	ClipBeatSnap     json.RawMessage `json:"clipbeatsnap"`
-	ClipTriggerStyle json.RawMessage `json:"cliptriggerstyle"`
+	Bypassed         ParamBoolean    `json:"bypassed"`
+	ClipBeatSnap     ParamChoice     `json:"clipbeatsnap"`
+	ClipTriggerStyle ParamChoice     `json:"cliptriggerstyle"`
 	Columns          []Column        `json:"columns"`
 	Crossfader       json.RawMessage `json:"crossfader"`
 	Dashboard        json.RawMessage `json:"dashboard"`
 	Decks            []Deck          `json:"decks"`
 	Layergroups      []LayerGroup    `json:"layergroups"`
 	Layers           []Layer         `json:"layers"`
-	Master           json.RawMessage `json:"master"`
-	Name             json.RawMessage `json:"name"`
-	Selected         json.RawMessage `json:"selected"`
-	Speed            json.RawMessage `json:"speed"`
+	Master           ParamRange      `json:"master"`
+	Name             ParamString     `json:"name"`
+	Selected         ParamBoolean    `json:"selected"`
+	Speed            ParamRange      `json:"speed"`
 	Tempcontroller   json.RawMessage `json:"tempcontroller"`
 	Video            json.RawMessage `json:"video"`
 }
 type Deck any
 
-type LayerGroup any
+// LayerGroup is a set of adjacent layers that share a master, bypass and
+// solo. Its layers are also listed in Composition.Layers.
+type LayerGroup struct {
+	Id                  int             `json:"id"`
+	Audio               json.RawMessage `json:"audio,omitempty"`
+	Bypassed            ParamBoolean    `json:"bypassed"`
+	Colorid             ParamChoice     `json:"colorid"`
+	CrossFaderGroup     ParamChoice     `json:"crossfadegroup"`
+	Dashboard           Params          `json:"dashboard,omitempty"`
+	IgnoreColumnTrigger ParamBoolean    `json:"ignorecolumntrigger"`
+	Layers              []Layer         `json:"layers"`
+	Master              ParamRange      `json:"master"`
+	Name                ParamString     `json:"name"`
+	Selected            ParamBoolean    `json:"selected"`
+	Solo                ParamBoolean    `json:"solo"`
+	Video               Video           `json:"video"`
+}
 
-type Column any
+type Column struct {
+	Id   int         `json:"id"`
+	Name ParamString `json:"name"`
+}
 
 type Layer struct {
 	Id                  int             `json:"id"`
 	Audio               json.RawMessage `json:"audio"`
 	Autopilot           json.RawMessage `json:"autopilot"`
-	Bypassed            json.RawMessage `json:"bypassed"`
+	Bypassed            ParamBoolean    `json:"bypassed"`
 	Clips               []Clip          `json:"clips"`
-	Colorid             json.RawMessage `json:"colorid"`
-	CrossFaderGroup     json.RawMessage `json:"crossfadegroup"`
-	Dashboard           json.RawMessage `json:"dashboard"`
-	FaderStart          json.RawMessage `json:"faderstart"`
-	IgnoreColumnTrigger json.RawMessage `json:"ignorecolumntrigger"`
-	MaskMode            json.RawMessage `json:"maskmode"`
-	Master              json.RawMessage `json:"master"`
-	Name                Parameter       `json:"name"`
-	Selected            json.RawMessage `json:"selected"`
-	Solo                json.RawMessage `json:"solo"`
+	Colorid             ParamChoice     `json:"colorid"`
+	CrossFaderGroup     ParamChoice     `json:"crossfadegroup"`
+	Dashboard           Params          `json:"dashboard"`
+	FaderStart          ParamBoolean    `json:"faderstart"`
+	IgnoreColumnTrigger ParamBoolean    `json:"ignorecolumntrigger"`
+	MaskMode            ParamChoice     `json:"maskmode"`
+	Master              ParamRange      `json:"master"`
+	Name                ParamString     `json:"name"`
+	Selected            ParamBoolean    `json:"selected"`
+	Solo                ParamBoolean    `json:"solo"`
 	Transition          json.RawMessage `json:"transition"`
 	Video               Video           `json:"video"`
 }
 
+// LayerById returns the layer and its 1 indexed position
+func (c Composition) LayerById(id int) (int, Layer, bool) {
+	for i, layer := range c.Layers {
+		if layer.Id == id {
+			return i + 1, layer, true
+		}
+	}
+	return 0, Layer{}, false
+}
+
+// GroupOf returns the 1 indexed position of the layer group containing the
+// layer, or false if the layer isn't grouped
+func (c Composition) GroupOf(layerId int) (int, LayerGroup, bool) {
+	for i, group := range c.Layergroups {
+		for _, layer := range group.Layers {
+			if layer.Id == layerId {
+				return i + 1, group, true
+			}
+		}
+	}
+	return 0, LayerGroup{}, false
+}
+
 type Todo map[string]interface{}
 
 type Clip struct {
-	Audio               Todo      `json:"audio"`
-	BeatSnap            Todo      `json:"beatsnap"`
-	Connected           Connected `json:"connected"`
-	Dashboard           Todo      `json:"dashboard"`
-	FaderStart          Todo      `json:"faderstart"`
-	Id                  int       `json:"id"`
-	IgnoreColumnTrigger Todo      `json:"ignorecolumntrigger"`
-	Name                Name      `json:"name"`
-	Selected            Todo      `json:"selected"`
-	Target              Todo      `json:"target"`
-	Thumbnail           Todo      `json:"thumbnail"`
-	TransportType       Todo      `json:"transporttype"`
-	TriggerStyle        Todo      `json:"triggerstyle"`
-	Video               ClipVideo `json:"video"`
-	Transport           Todo      `json:"transport"`
+	Audio               Todo         `json:"audio"`
+	BeatSnap            ParamChoice  `json:"beatsnap"`
+	Connected           ParamState   `json:"connected"`
+	Dashboard           Params       `json:"dashboard"`
+	FaderStart          ParamBoolean `json:"faderstart"`
+	Id                  int          `json:"id"`
+	IgnoreColumnTrigger ParamBoolean `json:"ignorecolumntrigger"`
+	Name                ParamString  `json:"name"`
+	Selected            ParamBoolean `json:"selected"`
+	Target              ParamChoice  `json:"target"`
+	Thumbnail           Todo         `json:"thumbnail"`
+	TransportType       ParamChoice  `json:"transporttype"`
+	TriggerStyle        ParamChoice  `json:"triggerstyle"`
+	Video               ClipVideo    `json:"video"`
+	Transport           Transport    `json:"transport"`
 }
 
-type Name struct {
-	Id        int       `json:"id"`
-	Value     string    `json:"value"`
-	ValueType ValueType `json:"valuetype"`
-}
+// The transport type and target of a clip that follows whatever an Engine
+// player is playing
+const (
+	TransportDenon = "Denon DJ"
+	TargetDenon    = "Denon Player Determined"
+)
 
-type Connected struct {
-	Value     string    `json:"value"`
-	ValueType ValueType `json:"valuetype"`
-	Options   []string  `json:"options"`
-	Index     int       `json:"index"`
-	Id        int       `json:"id,omitempty"`
+// Transport holds the playhead and the controls of the clip's transport
+// type. The controls differ between Timeline, BPM Sync, Denon DJ, etc.
+type Transport struct {
+	Position ParamRange `json:"position"`
+	Controls Params     `json:"controls,omitempty"`
 }
 
 type ClipVideo struct {
-	A            Todo     `json:"a"`
-	B            Todo     `json:"b"`
-	Description  string   `json:"description"`
-	Effects      []Todo   `json:"effects"`
-	FileInfo     FileInfo `json:"fileinfo"`
-	G            Todo     `json:"g"`
-	Height       int      `json:"height"`
-	Mixer        Todo     `json:"mixer"`
-	Opacity      Todo     `json:"opacity"`
-	R            Todo     `json:"r"`
-	Resize       Todo     `json:"resize"`
-	SourceParams Todo     `json:"sourceparams"`
-	Width        int      `json:"width"`
+	A            ParamBoolean `json:"a"`
+	B            ParamBoolean `json:"b"`
+	Description  string       `json:"description"`
+	Effects      []Todo       `json:"effects"`
+	FileInfo     FileInfo     `json:"fileinfo"`
+	G            ParamBoolean `json:"g"`
+	Height       int          `json:"height"`
+	Mixer        Todo         `json:"mixer"`
+	Opacity      ParamRange   `json:"opacity"`
+	R            ParamBoolean `json:"r"`
+	Resize       ParamChoice  `json:"resize"`
+	SourceParams Params       `json:"sourceparams"`
+	Width        int          `json:"width"`
 }
 
 type FileInfo struct {
@@ -116,15 +158,9 @@ type Video struct {
 	Height   int             `json:"height"`
 	Width    int             `json:"width"`
 	Mixer    json.RawMessage `json:"mixer"`
-	Opacity  json.RawMessage `json:"opacity"`
+	Opacity  ParamRange      `json:"opacity"`
 }
 
 type Effect Todo
 
-type Parameter struct {
-	ValueType string `json:"valuetype"`
-	Id        int    `json:"id"`
-	Value     any    `json:"value"`
-}
-
 type ValueType string
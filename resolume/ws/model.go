@@ -0,0 +1,58 @@
+package ws
+
+import (
+	"encoding/json"
+)
+
+// model is the composition as a generic JSON tree, with every parameter
+// indexed by id so updates can be patched in place.
+type model struct {
+	root   map[string]any
+	params map[int]map[string]any
+}
+
+func newModel(data []byte) (*model, error) {
+	m := &model{
+		params: make(map[int]map[string]any),
+	}
+	if err := json.Unmarshal(data, &m.root); err != nil {
+		return nil, err
+	}
+	m.index(m.root)
+	return m, nil
+}
+
+func (m *model) index(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		if _, ok := v["valuetype"]; ok {
+			if id, ok := v["id"].(float64); ok {
+				m.params[int(id)] = v
+			}
+		}
+		for _, child := range v {
+			m.index(child)
+		}
+	case []any:
+		for _, child := range v {
+			m.index(child)
+		}
+	}
+}
+
+// apply copies the fields of an update onto the parameter with the given id
+func (m *model) apply(id int, data []byte) {
+	p, ok := m.params[id]
+	if !ok {
+		return
+	}
+	var u map[string]any
+	if err := json.Unmarshal(data, &u); err != nil {
+		return
+	}
+	delete(u, "type")
+	delete(u, "path")
+	for k, v := range u {
+		p[k] = v
+	}
+}
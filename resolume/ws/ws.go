@@ -0,0 +1,361 @@
+// Package ws talks to the Resolume WebSocket API. It keeps a live copy of the
+// composition up to date from the updates Arena pushes, and fans parameter
+// updates out to subscribers over channels.
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmurray/resolumeconverter/resolume"
+	"github.com/gorilla/websocket"
+)
+
+var ErrNotConnected = errors.New("not connected to resolume")
+
+// Update is a parameter value pushed by Resolume
+type Update struct {
+	Id        int                `json:"id"`
+	Path      string             `json:"path"`
+	ValueType resolume.ValueType `json:"valuetype"`
+	Value     json.RawMessage    `json:"value"`
+
+	// Param is the decoded parameter, or nil if the type is unknown
+	Param resolume.Param `json:"-"`
+}
+
+type Client struct {
+	url    *url.URL
+	dialer *websocket.Dialer
+	log    *slog.Logger
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	writeMu sync.Mutex
+
+	mu    sync.Mutex
+	conn  *websocket.Conn
+	model *model
+	subs  map[int][]chan Update
+	ready chan struct{}
+}
+
+type Option func(*Client)
+
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) {
+		c.log = l
+	}
+}
+
+func WithDialer(d *websocket.Dialer) Option {
+	return func(c *Client) {
+		c.dialer = d
+	}
+}
+
+// WithBackoff sets the delay between reconnect attempts. It starts at min and
+// doubles up to max while Arena stays unreachable.
+func WithBackoff(min, max time.Duration) Option {
+	return func(c *Client) {
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+func NewClient(u *url.URL, opts ...Option) *Client {
+	c := &Client{
+		url:        u,
+		dialer:     websocket.DefaultDialer,
+		log:        slog.Default().With("pkg", "resolume/ws"),
+		minBackoff: 500 * time.Millisecond,
+		maxBackoff: 10 * time.Second,
+		subs:       make(map[int][]chan Update),
+		ready:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// URLFromBase derives the WebSocket endpoint from the REST base URL, eg
+// http://127.0.0.1:8089/api/v1/ becomes ws://127.0.0.1:8089/api/v1
+func URLFromBase(base *url.URL) *url.URL {
+	u := *base
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return &u
+}
+
+// Run connects to Resolume and reconnects whenever the connection drops. It
+// only returns once ctx is done.
+func (c *Client) Run(ctx context.Context) error {
+	backoff := c.minBackoff
+	for {
+		connected, err := c.runOnce(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if connected {
+			backoff = c.minBackoff
+		}
+		c.log.Warn("Disconnected from resolume", "error", err, "retry", backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+func (c *Client) runOnce(ctx context.Context) (bool, error) {
+	conn, _, err := c.dialer.DialContext(ctx, c.url.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c.mu.Lock()
+	c.conn = conn
+	ids := make([]int, 0, len(c.subs))
+	for id := range c.subs {
+		ids = append(ids, id)
+	}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+	}()
+	c.log.Info("Connected to resolume", "url", c.url.String())
+
+	// Subscriptions don't survive a reconnect, so ask again
+	for _, id := range ids {
+		if err := c.send(ctx, action{Action: "subscribe", Parameter: paramPath(id)}); err != nil {
+			return true, err
+		}
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+		if err := c.handle(data); err != nil {
+			c.log.Warn("Error handling message", "error", err)
+		}
+	}
+}
+
+func (c *Client) handle(data []byte) error {
+	var head struct {
+		Type   string          `json:"type"`
+		Error  string          `json:"error"`
+		Layers json.RawMessage `json:"layers"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return err
+	}
+	switch head.Type {
+	case "":
+		// A message without a type is the whole composition, sent on connect
+		// and whenever its structure changes
+		if head.Layers == nil {
+			return nil
+		}
+		m, err := newModel(data)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.model = m
+		select {
+		case <-c.ready:
+		default:
+			close(c.ready)
+		}
+		c.mu.Unlock()
+	case "parameter_update", "parameter_subscribed":
+		var u Update
+		if err := json.Unmarshal(data, &u); err != nil {
+			return err
+		}
+		if p, err := resolume.DecodeAnyParam(data); err == nil {
+			u.Param = p
+		}
+		c.mu.Lock()
+		if c.model != nil {
+			c.model.apply(u.Id, data)
+		}
+		for _, ch := range c.subs[u.Id] {
+			select {
+			case ch <- u:
+			default:
+				c.log.Warn("Subscriber is not keeping up, dropping update", "id", u.Id)
+			}
+		}
+		c.mu.Unlock()
+	case "error":
+		return fmt.Errorf("resolume: %s", head.Error)
+	}
+	return nil
+}
+
+// Ready is closed once the first composition has been received
+func (c *Client) Ready() <-chan struct{} {
+	return c.ready
+}
+
+// Composition returns the latest composition. It is false until Resolume
+// has sent one.
+func (c *Client) Composition() (resolume.Composition, bool) {
+	var v resolume.Composition
+	c.mu.Lock()
+	m := c.model
+	var data []byte
+	var err error
+	if m != nil {
+		data, err = json.Marshal(m.root)
+	}
+	c.mu.Unlock()
+	if m == nil || err != nil {
+		return v, false
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		c.log.Warn("Error decoding composition", "error", err)
+		return v, false
+	}
+	return v, true
+}
+
+// Subscribe delivers updates to the parameter with the given id until the
+// returned cancel func is called or the context is done. Subscriptions are
+// kept across reconnects.
+func (c *Client) Subscribe(ctx context.Context, id int) (<-chan Update, func()) {
+	ch := make(chan Update, 16)
+
+	c.mu.Lock()
+	first := len(c.subs[id]) == 0
+	c.subs[id] = append(c.subs[id], ch)
+	c.mu.Unlock()
+
+	if first {
+		// If we're not connected it's sent when we are
+		if err := c.send(ctx, action{Action: "subscribe", Parameter: paramPath(id)}); err != nil && !errors.Is(err, ErrNotConnected) {
+			c.log.Warn("Error subscribing", "id", id, "error", err)
+		}
+	}
+
+	var once sync.Once
+	done := make(chan struct{})
+	cancel := func() {
+		once.Do(func() {
+			close(done)
+			c.mu.Lock()
+			subs := c.subs[id]
+			for i, s := range subs {
+				if s == ch {
+					subs = append(subs[:i], subs[i+1:]...)
+					break
+				}
+			}
+			last := len(subs) == 0
+			if last {
+				delete(c.subs, id)
+			} else {
+				c.subs[id] = subs
+			}
+			close(ch)
+			c.mu.Unlock()
+			if last {
+				// ctx may be what cancelled us, so don't let it stop the unsubscribe
+				c.send(context.Background(), action{Action: "unsubscribe", Parameter: paramPath(id)})
+			}
+		})
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-done:
+		}
+	}()
+	return ch, cancel
+}
+
+// Set changes the value of a parameter
+func (c *Client) Set(ctx context.Context, id int, value any) error {
+	return c.send(ctx, action{Action: "set", Parameter: paramPath(id), Value: value})
+}
+
+// Trigger presses and releases an event parameter, such as
+// /composition/columns/1/connect
+func (c *Client) Trigger(ctx context.Context, path string) error {
+	if err := c.send(ctx, action{Action: "trigger", Parameter: path, Value: true}); err != nil {
+		return err
+	}
+	return c.send(ctx, action{Action: "trigger", Parameter: path, Value: false})
+}
+
+type action struct {
+	Action    string `json:"action"`
+	Parameter string `json:"parameter"`
+	Value     any    `json:"value,omitempty"`
+}
+
+// writeTimeout bounds a write when ctx has no deadline of its own
+const writeTimeout = 5 * time.Second
+
+func (c *Client) send(ctx context.Context, a action) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(writeTimeout)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	return conn.WriteJSON(a)
+}
+
+func paramPath(id int) string {
+	return fmt.Sprintf("/parameter/by-id/%d", id)
+}
@@ -0,0 +1,324 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/bmurray/resolumeconverter/resolume"
+	"github.com/bmurray/resolumeconverter/resolume/resolumetest"
+	"github.com/gorilla/websocket"
+)
+
+// fakeArena pushes a composition to each client that connects, and hands the
+// connections and the actions they send to the test
+type fakeArena struct {
+	*httptest.Server
+	comp    resolume.Composition
+	conns   chan *websocket.Conn
+	actions chan action
+}
+
+func newFakeArena(t *testing.T, comp resolume.Composition) *fakeArena {
+	t.Helper()
+	a := &fakeArena{
+		comp:    comp,
+		conns:   make(chan *websocket.Conn, 4),
+		actions: make(chan action, 16),
+	}
+	var upgrader websocket.Upgrader
+	a.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		if err := conn.WriteJSON(a.comp); err != nil {
+			t.Errorf("writing composition: %v", err)
+		}
+		a.conns <- conn
+		for {
+			var act action
+			if err := conn.ReadJSON(&act); err != nil {
+				return
+			}
+			a.actions <- act
+		}
+	}))
+	t.Cleanup(a.Close)
+	return a
+}
+
+func (a *fakeArena) url() *url.URL {
+	u, _ := url.Parse(a.Server.URL + "/api/v1/")
+	return URLFromBase(u)
+}
+
+// conn waits for the next client to connect
+func (a *fakeArena) conn(t *testing.T) *websocket.Conn {
+	t.Helper()
+	select {
+	case conn := <-a.conns:
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not connect")
+		return nil
+	}
+}
+
+func (a *fakeArena) action(t *testing.T) action {
+	t.Helper()
+	select {
+	case act := <-a.actions:
+		return act
+	case <-time.After(5 * time.Second):
+		t.Fatal("no action received")
+		return action{}
+	}
+}
+
+// startClient runs a client against a until the test ends, and waits for it
+// to receive the composition
+func startClient(t *testing.T, a *fakeArena) *Client {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewClient(a.url(), WithBackoff(10*time.Millisecond, 50*time.Millisecond))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	select {
+	case <-c.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no composition received")
+	}
+	return c
+}
+
+func update(t *testing.T, conn *websocket.Conn, id int, value any) {
+	t.Helper()
+	err := conn.WriteJSON(map[string]any{
+		"type":      "parameter_update",
+		"id":        id,
+		"path":      paramPath(id),
+		"valuetype": resolume.ValueTypeString,
+		"value":     value,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestURLFromBase(t *testing.T) {
+	for base, want := range map[string]string{
+		"http://127.0.0.1:8089/api/v1/": "ws://127.0.0.1:8089/api/v1",
+		"https://arena.local/api/v1":    "wss://arena.local/api/v1",
+	} {
+		u, err := url.Parse(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := URLFromBase(u).String(); got != want {
+			t.Errorf("URLFromBase(%s) = %s, want %s", base, got, want)
+		}
+	}
+}
+
+func TestCompositionUpdates(t *testing.T) {
+	comp := resolumetest.NewComposition(2, 3)
+	a := newFakeArena(t, comp)
+	c := startClient(t, a)
+	conn := a.conn(t)
+
+	got, ok := c.Composition()
+	if !ok {
+		t.Fatal("no composition")
+	}
+	if len(got.Layers) != 2 || len(got.Layers[0].Clips) != 3 {
+		t.Fatalf("got %d layers, want 2 with 3 clips", len(got.Layers))
+	}
+
+	clip := comp.Layers[1].Clips[2]
+	ch, cancel := c.Subscribe(context.Background(), clip.Name.Id)
+	defer cancel()
+	if act := a.action(t); act.Action != "subscribe" || act.Parameter != paramPath(clip.Name.Id) {
+		t.Fatalf("got %+v, want a subscribe", act)
+	}
+	update(t, conn, clip.Name.Id, "Song")
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update received")
+	}
+
+	got, _ = c.Composition()
+	if name := got.Layers[1].Clips[2].Name.Value; name != "Song" {
+		t.Errorf("clip name is %q, want Song", name)
+	}
+	if name := got.Layers[0].Clips[2].Name.Value; name != "" {
+		t.Errorf("other clip's name is %q, want it unchanged", name)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	comp := resolumetest.NewComposition(1, 1)
+	a := newFakeArena(t, comp)
+	c := startClient(t, a)
+	conn := a.conn(t)
+	id := comp.Layers[0].Clips[0].Name.Id
+
+	ch, cancel := c.Subscribe(context.Background(), id)
+	a.action(t)
+	for _, v := range []string{"One", "Two"} {
+		update(t, conn, id, v)
+		select {
+		case u := <-ch:
+			var got string
+			json.Unmarshal(u.Value, &got)
+			if u.Id != id || got != v {
+				t.Errorf("got update %d %q, want %d %q", u.Id, got, id, v)
+			}
+			if p, ok := u.Param.(resolume.ParamString); !ok || p.Value != v {
+				t.Errorf("got param %#v, want a string param %q", u.Param, v)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no update for %q", v)
+		}
+	}
+
+	cancel()
+	if act := a.action(t); act.Action != "unsubscribe" {
+		t.Errorf("got %+v, want an unsubscribe", act)
+	}
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("got an update after cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+	// Cancelling twice is fine
+	cancel()
+}
+
+func TestSubscribeCancelStopsWatching(t *testing.T) {
+	c := NewClient(&url.URL{Scheme: "ws", Host: "127.0.0.1:1"})
+	before := runtime.NumGoroutine()
+	for id := range 100 {
+		_, cancel := c.Subscribe(context.Background(), id)
+		cancel()
+	}
+	// The goroutines watching the context go away once cancelled
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before+5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left, started with %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSetAndTrigger(t *testing.T) {
+	a := newFakeArena(t, resolumetest.NewComposition(1, 1))
+	c := startClient(t, a)
+	a.conn(t)
+	ctx := context.Background()
+
+	if err := c.Set(ctx, 42, "Denon DJ"); err != nil {
+		t.Fatal(err)
+	}
+	if act := a.action(t); act.Action != "set" || act.Parameter != paramPath(42) || act.Value != "Denon DJ" {
+		t.Errorf("got %+v, want a set of 42", act)
+	}
+
+	path := "/composition/columns/1/connect"
+	if err := c.Trigger(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []bool{true, false} {
+		act := a.action(t)
+		if act.Action != "trigger" || act.Parameter != path || act.Value != want {
+			t.Errorf("got %+v, want a trigger of %v", act, want)
+		}
+	}
+
+	done, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := c.Set(done, 42, "Timeline"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Set with a done context returned %v", err)
+	}
+}
+
+func TestNotConnected(t *testing.T) {
+	c := NewClient(&url.URL{Scheme: "ws", Host: "127.0.0.1:1"})
+	if err := c.Set(context.Background(), 1, true); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("got %v, want ErrNotConnected", err)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	comp := resolumetest.NewComposition(1, 1)
+	a := newFakeArena(t, comp)
+	c := startClient(t, a)
+	id := comp.Layers[0].Clips[0].Name.Id
+
+	_, cancel := c.Subscribe(context.Background(), id)
+	defer cancel()
+	a.action(t)
+
+	a.conn(t).Close()
+	conn := a.conn(t)
+	// The subscription is made again on the new connection
+	if act := a.action(t); act.Action != "subscribe" || act.Parameter != paramPath(id) {
+		t.Errorf("got %+v, want a subscribe", act)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := c.Set(context.Background(), id, "Again")
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrNotConnected) || time.Now().After(deadline) {
+			t.Fatalf("Set after reconnect: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if act := a.action(t); act.Action != "set" {
+		t.Errorf("got %+v, want a set", act)
+	}
+	conn.Close()
+}
+
+func TestBackoff(t *testing.T) {
+	// Nothing listens here, so every dial fails and the client keeps retrying
+	srv := httptest.NewServer(http.NotFoundHandler())
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	c := NewClient(URLFromBase(u), WithBackoff(10*time.Millisecond, 20*time.Millisecond))
+	start := time.Now()
+	if err := c.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run returned %v, want the context's error", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("Run didn't return when the context was done")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"strings"
+
+	"github.com/bmurray/resolumeconverter/library"
+)
+
+// globs is a flag that can be given more than once
+type globs []string
+
+func (g *globs) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *globs) Set(v string) error {
+	*g = append(*g, v)
+	return nil
+}
+
+// scanFlags are the flags of every command that reads a directory of videos
+type scanFlags struct {
+	include globs
+	exclude globs
+}
+
+func (f *scanFlags) register(fs *flag.FlagSet) {
+	fs.Var(&f.include, "include", "Only use files matching this glob, like \"*.mp4\" or \"House/*\" (can be repeated)")
+	fs.Var(&f.exclude, "exclude", "Skip files and folders matching this glob (can be repeated)")
+}
+
+// scan finds the videos in dir and its subdirectories, narrowed further by
+// opts
+func (f scanFlags) scan(ctx context.Context, dir string, opts ...library.ScannerOption) ([]library.File, error) {
+	opts = append([]library.ScannerOption{library.WithInclude(f.include...), library.WithExclude(f.exclude...)}, opts...)
+	s, err := library.NewScanner(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return s.Scan(ctx, dir)
+}
@@ -0,0 +1,302 @@
+// Package state remembers what has been done to each source video between
+// runs: what it was called, where its audio and video went, and which clip
+// it is in.
+//
+// Tracks are keyed by the sha256 of the source, so they survive renames. A
+// path index avoids hashing a file again as long as its size and modification
+// time haven't changed.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bmurray/resolumeconverter/journal"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketTracks = []byte("tracks")
+	bucketPaths  = []byte("paths")
+)
+
+// Track is everything known about one source video. Paths are absolute.
+type Track struct {
+	Hash         string `json:"sha256"`
+	OriginalName string `json:"original_name"`
+	Title        string `json:"title,omitempty"`
+	Artist       string `json:"artist,omitempty"`
+	// Path is where the source is now, after any rename
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	RenamedAt time.Time `json:"renamed_at"`
+
+	Audio   string    `json:"audio,omitempty"`
+	AudioAt time.Time `json:"audio_at"`
+	Video   string    `json:"video,omitempty"`
+	VideoAt time.Time `json:"video_at"`
+
+	ClipId     int       `json:"clip_id,omitempty"`
+	LayerId    int       `json:"layer_id,omitempty"`
+	Layer      int       `json:"layer,omitempty"`
+	Column     int       `json:"column,omitempty"`
+	ImportedAt time.Time `json:"imported_at"`
+
+	FirstSeen time.Time `json:"first_seen"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DB is the state store. A nil *DB is valid and records nothing, so commands
+// keep working when the store can't be opened.
+type DB struct {
+	db *bolt.DB
+}
+
+// DefaultPath is where the store lives unless told otherwise
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "resolumeconverter", "state.db")
+}
+
+type Option func(*options)
+
+type options struct {
+	readOnly bool
+}
+
+// WithReadOnly opens the store only to read it. Readers share the lock, so
+// they don't wait for each other, and nothing on disk is created or changed.
+func WithReadOnly() Option {
+	return func(o *options) {
+		o.readOnly = true
+	}
+}
+
+func Open(path string, opts ...Option) (*DB, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.readOnly {
+		// bolt would create it, even to only read it
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	} else {
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Another run holding the lock shouldn't hang this one forever
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: 2 * time.Second, ReadOnly: o.readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	if o.readOnly {
+		return &DB{db: db}, nil
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{bucketTracks, bucketPaths} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &DB{db: db}, nil
+}
+
+func (d *DB) Close() error {
+	if d == nil {
+		return nil
+	}
+	return d.db.Close()
+}
+
+// Identify returns the hash of the source at path, hashing it only if it is
+// new or has changed since it was last seen
+func (d *DB) Identify(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if d != nil {
+		var t Track
+		found := false
+		d.db.View(func(tx *bolt.Tx) error {
+			hash := tx.Bucket(bucketPaths).Get([]byte(path))
+			if hash == nil {
+				return nil
+			}
+			found = get(tx, string(hash), &t)
+			return nil
+		})
+		if found && t.Size == st.Size() && t.ModTime.Equal(st.ModTime()) {
+			return t.Hash, nil
+		}
+	}
+	return journal.HashFile(path)
+}
+
+// Source records the source at path and applies fn to its track, creating
+// the track the first time. It returns the track as saved.
+func (d *DB) Source(path string, fn func(*Track)) (Track, error) {
+	if d == nil {
+		return Track{}, nil
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return Track{}, err
+	}
+	hash, err := d.Identify(path)
+	if err != nil {
+		return Track{}, err
+	}
+	return d.Update(hash, func(t *Track) {
+		if t.OriginalName == "" {
+			t.OriginalName = filepath.Base(path)
+		}
+		t.Path = path
+		if fn != nil {
+			fn(t)
+		}
+	})
+}
+
+// Update applies fn to the track with hash, creating it if needed, and keeps
+// the path index in step with the track's path
+func (d *DB) Update(hash string, fn func(*Track)) (Track, error) {
+	if d == nil {
+		return Track{}, nil
+	}
+	var t Track
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		now := time.Now()
+		if !get(tx, hash, &t) {
+			t = Track{Hash: hash, FirstSeen: now}
+		}
+		oldPath := t.Path
+		fn(&t)
+		t.UpdatedAt = now
+		if st, err := os.Stat(t.Path); err == nil {
+			t.Size = st.Size()
+			t.ModTime = st.ModTime()
+		}
+
+		paths := tx.Bucket(bucketPaths)
+		if oldPath != "" && oldPath != t.Path {
+			if err := paths.Delete([]byte(oldPath)); err != nil {
+				return err
+			}
+		}
+		if t.Path != "" {
+			if err := paths.Put([]byte(t.Path), []byte(hash)); err != nil {
+				return err
+			}
+		}
+		b, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketTracks).Put([]byte(hash), b)
+	})
+	return t, err
+}
+
+// Get returns the track with hash
+func (d *DB) Get(hash string) (Track, bool) {
+	if d == nil {
+		return Track{}, false
+	}
+	var t Track
+	found := false
+	d.db.View(func(tx *bolt.Tx) error {
+		found = get(tx, hash, &t)
+		return nil
+	})
+	return t, found
+}
+
+// FindVideo returns the track whose video output is path
+func (d *DB) FindVideo(path string) (Track, bool) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return Track{}, false
+	}
+	tracks, err := d.All()
+	if err != nil {
+		return Track{}, false
+	}
+	for _, t := range tracks {
+		if t.Video == path {
+			return t, true
+		}
+	}
+	return Track{}, false
+}
+
+// Videos returns every track that has a video, by the video's path
+func (d *DB) Videos() (map[string]Track, error) {
+	tracks, err := d.All()
+	if err != nil {
+		return nil, err
+	}
+	videos := make(map[string]Track)
+	for _, t := range tracks {
+		if t.Video != "" {
+			videos[t.Video] = t
+		}
+	}
+	return videos, nil
+}
+
+// All returns every track, ordered by title and then path
+func (d *DB) All() ([]Track, error) {
+	if d == nil {
+		return nil, errors.New("no state database")
+	}
+	var tracks []Track
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketTracks).ForEach(func(k, v []byte) error {
+			var t Track
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("track %s: %w", k, err)
+			}
+			tracks = append(tracks, t)
+			return nil
+		})
+	})
+	sort.Slice(tracks, func(i, j int) bool {
+		if tracks[i].Title != tracks[j].Title {
+			return tracks[i].Title < tracks[j].Title
+		}
+		return tracks[i].Path < tracks[j].Path
+	})
+	return tracks, err
+}
+
+func get(tx *bolt.Tx, hash string, t *Track) bool {
+	v := tx.Bucket(bucketTracks).Get([]byte(hash))
+	if v == nil {
+		return false
+	}
+	return json.Unmarshal(v, t) == nil
+}
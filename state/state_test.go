@@ -0,0 +1,281 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bmurray/resolumeconverter/journal"
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTemp(t *testing.T) (*DB, string) {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := Open(filepath.Join(dir, "state", "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, dir
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// indexed returns the hash the path index has for path
+func indexed(t *testing.T, d *DB, path string) string {
+	t.Helper()
+	var hash string
+	d.db.View(func(tx *bolt.Tx) error {
+		hash = string(tx.Bucket(bucketPaths).Get([]byte(path)))
+		return nil
+	})
+	return hash
+}
+
+func TestIdentifyCache(t *testing.T) {
+	db, dir := openTemp(t)
+	file := filepath.Join(dir, "song.mp4")
+	writeFile(t, file, "first")
+	want, err := journal.HashFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	track, err := db.Source(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track.Hash != want {
+		t.Fatalf("got hash %s, want %s", track.Hash, want)
+	}
+
+	// Same size and time, so the cached hash is trusted without reading
+	st, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, file, "other")
+	if err := os.Chtimes(file, st.ModTime(), st.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.Identify(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got hash %s, want the cached %s", got, want)
+	}
+
+	// A new time means the file is hashed again
+	later := st.ModTime().Add(time.Minute)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	got, err = db.Identify(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == want {
+		t.Error("a changed file got its old hash")
+	}
+	rehashed, _ := journal.HashFile(file)
+	if got != rehashed {
+		t.Errorf("got hash %s, want %s", got, rehashed)
+	}
+
+	// So does a new size
+	writeFile(t, file, "longer than before")
+	got, err = db.Identify(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rehashed, _ := journal.HashFile(file); got != rehashed {
+		t.Errorf("got hash %s, want %s", got, rehashed)
+	}
+}
+
+func TestUpdateMovesPath(t *testing.T) {
+	db, dir := openTemp(t)
+	from := filepath.Join(dir, "Artist - Song (Official Video).mp4")
+	to := filepath.Join(dir, "Song.mp4")
+	writeFile(t, from, "video")
+
+	track, err := db.Source(from, func(tr *Track) {
+		tr.Title = "Song"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexed(t, db, from) != track.Hash {
+		t.Fatal("source isn't in the path index")
+	}
+
+	if err := os.Rename(from, to); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Update(track.Hash, func(tr *Track) {
+		tr.Path = to
+		tr.RenamedAt = time.Now()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash := indexed(t, db, from); hash != "" {
+		t.Errorf("old path is still indexed to %s", hash)
+	}
+	if hash := indexed(t, db, to); hash != track.Hash {
+		t.Errorf("new path is indexed to %q, want %s", hash, track.Hash)
+	}
+
+	got, ok := db.Get(track.Hash)
+	if !ok {
+		t.Fatal("track is gone")
+	}
+	if got.OriginalName != filepath.Base(from) || got.Path != to || got.Title != "Song" {
+		t.Errorf("got %+v", got)
+	}
+	if got.RenamedAt.IsZero() || got.FirstSeen.IsZero() || !got.FirstSeen.Equal(track.FirstSeen) {
+		t.Errorf("got times renamed %v first seen %v, want first seen %v", got.RenamedAt, got.FirstSeen, track.FirstSeen)
+	}
+	// The rename kept the time, so the new path doesn't need hashing
+	if st, _ := os.Stat(to); got.Size != st.Size() || !got.ModTime.Equal(st.ModTime()) {
+		t.Errorf("got size %d time %v, want %d %v", got.Size, got.ModTime, st.Size(), st.ModTime())
+	}
+}
+
+func TestFindVideo(t *testing.T) {
+	db, dir := openTemp(t)
+	file := filepath.Join(dir, "song.mp4")
+	writeFile(t, file, "video")
+	video := filepath.Join(dir, "out", "song.mov")
+	track, err := db.Source(file, func(tr *Track) {
+		tr.Video = video
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := db.FindVideo(video)
+	if !ok || got.Hash != track.Hash {
+		t.Errorf("got %+v %v, want the track", got, ok)
+	}
+	if _, ok := db.FindVideo(file); ok {
+		t.Error("found a track by its source")
+	}
+}
+
+func TestVideos(t *testing.T) {
+	db, dir := openTemp(t)
+	var want []Track
+	for _, name := range []string{"a", "b"} {
+		file := filepath.Join(dir, name+".mp4")
+		writeFile(t, file, name)
+		track, err := db.Source(file, func(tr *Track) {
+			tr.Video = filepath.Join(dir, "out", name+".mov")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, track)
+	}
+	// No video yet
+	writeFile(t, filepath.Join(dir, "c.mp4"), "c")
+	if _, err := db.Source(filepath.Join(dir, "c.mp4"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	videos, err := db.Videos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(videos) != len(want) {
+		t.Errorf("got %d videos, want %d", len(videos), len(want))
+	}
+	for _, track := range want {
+		if got, ok := videos[track.Video]; !ok || got.Hash != track.Hash {
+			t.Errorf("got %+v for %s, want %s", got, track.Video, track.Hash)
+		}
+	}
+}
+
+func TestNilDB(t *testing.T) {
+	var db *DB
+	dir := t.TempDir()
+	file := filepath.Join(dir, "song.mp4")
+	writeFile(t, file, "video")
+
+	if err := db.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	// Identify still works, it just can't remember
+	hash, err := db.Identify(file)
+	if want, _ := journal.HashFile(file); err != nil || hash != want {
+		t.Errorf("Identify got %s %v, want %s", hash, err, want)
+	}
+	if track, err := db.Source(file, func(*Track) { t.Error("Source called fn") }); err != nil || track.Hash != "" {
+		t.Errorf("Source got %+v %v", track, err)
+	}
+	if track, err := db.Update(hash, func(*Track) { t.Error("Update called fn") }); err != nil || track.Hash != "" {
+		t.Errorf("Update got %+v %v", track, err)
+	}
+	if _, ok := db.Get(hash); ok {
+		t.Error("Get found a track")
+	}
+	if _, ok := db.FindVideo(file); ok {
+		t.Error("FindVideo found a track")
+	}
+	if _, err := db.Videos(); err == nil {
+		t.Error("Videos didn't say there's no database")
+	}
+	if _, err := db.All(); err == nil {
+		t.Error("All didn't say there's no database")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.db")
+	if _, err := Open(path, WithReadOnly()); err == nil {
+		t.Error("opened a database that doesn't exist")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("opening read-only created the database")
+	}
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "song.mp4")
+	writeFile(t, file, "video")
+	track, err := db.Source(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Readers don't lock each other out
+	a, err := Open(path, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := Open(path, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if _, ok := b.Get(track.Hash); !ok {
+		t.Error("track not found read-only")
+	}
+	if _, err := a.Update(track.Hash, func(tr *Track) { tr.Title = "Changed" }); err == nil {
+		t.Error("updated a read-only database")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/bmurray/resolumeconverter/encoder"
+	"github.com/bmurray/resolumeconverter/plan"
+	"github.com/bmurray/resolumeconverter/state"
+)
+
+// status shows how far each track has got through the pipeline
+func status(db *state.DB, args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	format := formatFlag(fs, "format", plan.FormatTable, plan.FormatJSON)
+	fs.Parse(args)
+
+	tracks, err := db.All()
+	if err != nil {
+		slog.Error("Error reading state", "error", err)
+		return
+	}
+	if format.value == plan.FormatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if tracks == nil {
+			tracks = []state.Track{}
+		}
+		err := enc.Encode(tracks)
+		if err != nil {
+			slog.Error("Error writing status", "error", err)
+		}
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tTITLE\tSOURCE\tAUDIO\tVIDEO\tCLIP")
+	for _, t := range tracks {
+		clip := "-"
+		if !t.ImportedAt.IsZero() {
+			clip = fmt.Sprintf("layer %d column %d", t.Layer, t.Column)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", stage(t), t.Title, fileStatus(t.Path), fileStatus(t.Audio), fileStatus(t.Video), clip)
+	}
+	tw.Flush()
+}
+
+// stage is the last step done for a track
+func stage(t state.Track) string {
+	switch {
+	case !t.ImportedAt.IsZero():
+		return "imported"
+	case t.Video != "":
+		return "video"
+	case t.Audio != "":
+		return "audio"
+	case !t.RenamedAt.IsZero():
+		return "renamed"
+	}
+	return "seen"
+}
+
+// fileStatus is the base name of path, marked if the file has since gone
+func fileStatus(path string) string {
+	if path == "" {
+		return "-"
+	}
+	if !encoder.OutputExists(path) {
+		return filepath.Base(path) + " (missing)"
+	}
+	return filepath.Base(path)
+}
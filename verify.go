@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bmurray/resolumeconverter/encoder"
+	"github.com/bmurray/resolumeconverter/library"
+	"github.com/bmurray/resolumeconverter/match"
+	"github.com/bmurray/resolumeconverter/plan"
+	"github.com/bmurray/resolumeconverter/resolume"
+)
+
+// syncProblem is a track that won't sync, and why
+type syncProblem struct {
+	Audio   string `json:"audio"`
+	Title   string `json:"title"`
+	Problem string `json:"problem"`
+}
+
+// namedClip is a clip in the composition that has a name
+type namedClip struct {
+	name   string
+	path   string
+	layer  int
+	column int
+}
+
+// verify checks that every audio file's title, which is what Engine sends,
+// has a video named after it and a clip with that name in Arena. It returns
+// the exit code.
+func verify(ctx context.Context, r *resolume.Resolume, args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	format := formatFlag(fs, "format", plan.FormatTable, plan.FormatJSON)
+	offline := fs.Bool("offline", false, "Don't check the clips in Arena")
+	var scan scanFlags
+	scan.register(fs)
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) < 2 {
+		slog.Error("Need an audio dir and a video dir")
+		return exitError
+	}
+	audioDir, videoDir := args[0], args[1]
+
+	s, err := library.NewScanner(library.WithAudio(), library.WithInclude(scan.include...), library.WithExclude(scan.exclude...))
+	if err != nil {
+		slog.Error("Error scanning files", "error", err)
+		return exitError
+	}
+	audios, err := s.Scan(ctx, audioDir)
+	if err != nil {
+		slog.Error("Error scanning files", "error", err)
+		return exitError
+	}
+	videos, err := scan.scan(ctx, videoDir)
+	if err != nil {
+		slog.Error("Error scanning files", "error", err)
+		return exitError
+	}
+	var clips []namedClip
+	if !*offline {
+		clips, err = compositionClips(ctx, r)
+		if err != nil {
+			slog.Error("Error getting composition, use -offline to skip the clips", "error", err)
+			return exitError
+		}
+	}
+
+	enc := encoder.NewEncoder()
+	titles := make(map[string]string, len(audios))
+	unreadable := make(map[string]error)
+	sameTitle := make(map[string][]string)
+	for _, a := range audios {
+		data, err := enc.GetMetadata(ctx, a.Path)
+		if err != nil {
+			slog.Error("Error reading tags", "file", a.Path, "error", err)
+			unreadable[a.Path] = err
+			continue
+		}
+		titles[a.Path] = data.Tag("title")
+		key := match.Key(titles[a.Path])
+		sameTitle[key] = append(sameTitle[key], a.Path)
+	}
+
+	videoIndex := newNameIndex(videoNames(videos))
+	clipIndex := newNameIndex(clipNames(clips))
+	clipsByPath := make(map[string]namedClip, len(clips))
+	for _, c := range clips {
+		if _, ok := clipsByPath[c.path]; !ok {
+			clipsByPath[c.path] = c
+		}
+	}
+
+	var problems []syncProblem
+	for _, a := range audios {
+		title := titles[a.Path]
+		add := func(format string, v ...any) {
+			problems = append(problems, syncProblem{Audio: a.Path, Title: title, Problem: fmt.Sprintf(format, v...)})
+		}
+		if err, ok := unreadable[a.Path]; ok {
+			add("can't read tags: %v", err)
+			continue
+		}
+		if title == "" {
+			add("no title tag")
+			continue
+		}
+		for _, other := range sameTitle[match.Key(title)] {
+			if other != a.Path {
+				add("%s has the same title", other)
+			}
+		}
+		var video string
+		if i, ok := videoIndex.find(title); ok {
+			video = videos[i].Path
+		} else {
+			add("%s", videoIndex.missing("video", title))
+		}
+		if *offline {
+			continue
+		}
+		if _, ok := clipIndex.find(title); ok {
+			continue
+		}
+		if clip, ok := clipOf(clipsByPath, video); ok {
+			add("the clip for %s in layer %d column %d is named %q", filepath.Base(video), clip.layer, clip.column, clip.name)
+			continue
+		}
+		add("%s", clipIndex.missing("clip", title))
+	}
+
+	if format.value == plan.FormatJSON {
+		if problems == nil {
+			problems = []syncProblem{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(problems)
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "AUDIO\tTITLE\tPROBLEM")
+		for _, p := range problems {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", p.Audio, p.Title, p.Problem)
+		}
+		tw.Flush()
+	}
+	slog.Info("Verified", "tracks", len(audios), "problems", len(problems))
+	if len(problems) > 0 {
+		return exitDiffers
+	}
+	return exitSame
+}
+
+// compositionClips lists every clip with a name, in every layer
+func compositionClips(ctx context.Context, r *resolume.Resolume) ([]namedClip, error) {
+	comp, err := r.GetComposition(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var clips []namedClip
+	for l, layer := range comp.Layers {
+		for c, clip := range layer.Clips {
+			if clip.Name.Value == "" {
+				continue
+			}
+			clips = append(clips, namedClip{
+				name:   clip.Name.Value,
+				path:   clip.Video.FileInfo.Path,
+				layer:  l + 1,
+				column: c + 1,
+			})
+		}
+	}
+	return clips, nil
+}
+
+// baseName is a file's name without its extension, which is what a clip is
+// named when the file is imported
+func baseName(file string) string {
+	base := filepath.Base(file)
+	return base[:len(base)-len(filepath.Ext(base))]
+}
+
+// clipOf finds the clip playing video in clips, which are keyed by path
+func clipOf(clips map[string]namedClip, video string) (namedClip, bool) {
+	if video == "" {
+		return namedClip{}, false
+	}
+	abs, err := filepath.Abs(video)
+	if err != nil {
+		return namedClip{}, false
+	}
+	c, ok := clips[abs]
+	return c, ok
+}
+
+func videoNames(videos []library.File) []string {
+	names := make([]string, len(videos))
+	for i, v := range videos {
+		names[i] = baseName(v.Path)
+	}
+	return names
+}
+
+func clipNames(clips []namedClip) []string {
+	names := make([]string, len(clips))
+	for i, c := range clips {
+		names[i] = c.name
+	}
+	return names
+}
+
+// nameIndex looks names up by the key Resolume compares, and by their loose
+// form to find near misses, so checking a title doesn't mean comparing it
+// with every name
+type nameIndex struct {
+	names   []string
+	byKey   map[string]int
+	byLoose map[string][]int
+}
+
+func newNameIndex(names []string) nameIndex {
+	idx := nameIndex{
+		names:   names,
+		byKey:   make(map[string]int, len(names)),
+		byLoose: make(map[string][]int),
+	}
+	for i, name := range names {
+		key := match.Key(name)
+		if _, ok := idx.byKey[key]; !ok {
+			idx.byKey[key] = i
+		}
+		loose := match.Loose(name)
+		idx.byLoose[loose] = append(idx.byLoose[loose], i)
+	}
+	return idx
+}
+
+// find returns the index of the first name Resolume treats as title
+func (idx nameIndex) find(title string) (int, bool) {
+	i, ok := idx.byKey[match.Key(title)]
+	return i, ok
+}
+
+// missing explains why nothing called title was found: a near miss if there
+// is one, otherwise that there is nothing like it
+func (idx nameIndex) missing(kind, title string) string {
+	for _, i := range idx.byLoose[match.Loose(title)] {
+		name := idx.names[i]
+		if diffs, ok := match.Explain(title, name); ok && diffs != nil {
+			return fmt.Sprintf("%s %q differs in %s", kind, name, strings.Join(diffs, " and "))
+		}
+	}
+	return fmt.Sprintf("no %s named %q", kind, title)
+}